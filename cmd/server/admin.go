@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/config"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// runAdmin implements the admin subcommand, which grants or revokes the admin
+// role from the command line, so the first admin can be created.
+func runAdmin(ctx context.Context, cfg config.Config, args []string) {
+	if len(args) != 2 || (args[0] != "grant" && args[0] != "revoke") {
+		fmt.Fprintln(os.Stderr, "Usage: admin grant|revoke EMAIL")
+		os.Exit(2)
+	}
+	role := "admin"
+	if args[0] == "revoke" {
+		role = "user"
+	}
+	db, err := openDB(ctx, cfg.Database)
+	if err != nil {
+		fatal("Unable to reach db, check DB_URL", "error", err)
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		fatal("Unable to start transaction", "error", err)
+	}
+	defer tx.Rollback()
+	q := database.New(tx)
+	user, err := q.GetUserByEmail(ctx, args[1])
+	if err != nil {
+		fatal("Unable to find user", "email", args[1], "error", err)
+	}
+	_, err = q.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: role})
+	if err != nil {
+		fatal("Unable to set role", "error", err)
+	}
+	err = audit.Record(ctx, q, audit.Event{
+		ActorID:    uuid.NullUUID{},
+		Action:     audit.ActionUserSetRole,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.NullID(user.ID),
+		Details:    map[string]any{"role": role, "source": "cli"},
+	})
+	if err != nil {
+		fatal("Unable to record audit event", "error", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		fatal("Unable to commit", "error", err)
+	}
+	slog.Info("Updated user role", "user_id", user.ID, "role", role)
+}
@@ -1,72 +1,411 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
-	"sync/atomic"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
+	"github.com/finchrelia/chirpy-server/internal/config"
 	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/dbtx"
 	"github.com/finchrelia/chirpy-server/internal/handler"
-	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/finchrelia/chirpy-server/internal/health"
+	"github.com/finchrelia/chirpy-server/internal/httpx"
+	"github.com/finchrelia/chirpy-server/internal/jobs"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/metrics"
+	"github.com/finchrelia/chirpy-server/internal/migrate"
+	"github.com/finchrelia/chirpy-server/internal/ratelimit"
+	"github.com/finchrelia/chirpy-server/internal/stream"
+	"github.com/finchrelia/chirpy-server/internal/tracing"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
+	"github.com/lib/pq"
 )
 
+// streamBuffer is how many chirp events a stream client may fall behind by
+// before it is dropped.
+const streamBuffer = 64
+
+// jobPruneRateLimitBuckets is the kind of the job pruning the buckets of
+// the postgres rate limit store.
+const jobPruneRateLimitBuckets = "rate_limit_buckets.prune"
+
+// webhookInterval is how often due webhook deliveries are sent.
+const webhookInterval = 5 * time.Second
+
 func main() {
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		log.Fatalf("Empty dbURL !")
+	configPath := flag.String("config", os.Getenv("CHIRPY_CONFIG"), "path to a YAML or TOML config file")
+	printConfig := flag.Bool("print-config", false, "print the resolved configuration, secrets redacted, and exit")
+	migrateOnStart := flag.Bool("migrate-on-start", false, "apply pending migrations before serving")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up|down|status|redo | admin grant|revoke EMAIL]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// The configuration is printed before being validated, invalid ones
+	// being those operators most need to look at.
+	cfg, err := config.Load(*configPath)
+	if *printConfig {
+		out, printErr := cfg.Redacted().YAML()
+		if printErr != nil {
+			fmt.Fprintf(os.Stderr, "Unable to print configuration: %v\n", printErr)
+			os.Exit(1)
+		}
+		fmt.Print(out)
+	}
+	err = errors.Join(err, cfg.Validate())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
 	}
-	platform := os.Getenv("PLATFORM")
-	if platform == "" {
-		log.Fatalf("Empty PLATFORM env var!")
+	if *printConfig {
+		return
 	}
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatalf("Empty JWT_SECRET env var!")
+	if *migrateOnStart {
+		cfg.Database.MigrateOnStart = true
 	}
-	polkaKey := os.Getenv("POLKA_KEY")
-	if polkaKey == "" {
-		log.Fatalf("Empty POLKA_KEY env var!")
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to set up logging: %v\n", err)
+		os.Exit(1)
 	}
-	db, err := sql.Open("postgres", dbURL)
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch flag.Arg(0) {
+	case "":
+		serve(ctx, stop, cfg, logger)
+	case "migrate":
+		runMigrate(ctx, cfg, flag.Args()[1:])
+	case "admin":
+		runAdmin(ctx, cfg, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func serve(ctx context.Context, stop context.CancelFunc, cfg config.Config, logger *slog.Logger) {
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Exporter, cfg.Tracing.Endpoint)
 	if err != nil {
-		log.Fatalf("Unable to connect to db: %v", err)
+		fatal("Unable to set up tracing", "error", err)
 	}
+
+	appMetrics := metrics.New()
+	db, err := openDB(ctx, cfg.Database, tracing.QueryHook(), appMetrics.QueryHook())
+	if err != nil {
+		fatal("Unable to reach db, check DB_URL", "error", err)
+	}
+	if cfg.Database.MigrateOnStart {
+		err = migrateUp(ctx, db)
+		if err != nil {
+			fatal("Unable to migrate db", "error", err)
+		}
+	}
+
 	apiCfg := &handler.APIConfig{
-		FileserverHits: atomic.Int32{},
-		DB:             database.New(db),
-		Platform:       platform,
-		JWT:            jwtSecret,
-		PolkaKey:       polkaKey,
+		DB:                    database.New(db),
+		Conn:                  db,
+		Stats:                 appMetrics,
+		Stream:                stream.NewHub(database.New(db), streamBuffer),
+		Platform:              cfg.Platform,
+		JWT:                   cfg.Auth.JWTSecret,
+		PolkaKey:              cfg.Auth.PolkaKey,
+		AccessTokenTTL:        cfg.Auth.AccessTokenTTL,
+		RefreshTokenTTL:       cfg.Auth.RefreshTokenTTL,
+		MaxChirpLength:        cfg.Chirps.MaxLength,
+		BannedWords:           cfg.Chirps.BannedWords,
+		UndeleteWindow:        cfg.Chirps.UndeleteWindow,
+		DeletedChirpRetention: cfg.Chirps.DeletedRetention,
+		DeletionGracePeriod:   cfg.Accounts.DeletionGracePeriod,
+		ExportDir:             cfg.Accounts.ExportDir,
+		ExportTTL:             cfg.Accounts.ExportTTL,
+		AuditRetention:        cfg.Audit.Retention,
+		ReportHideThreshold:   cfg.Reports.HideThreshold,
+	}
+	runner := jobs.NewRunner(apiCfg.DB, cfg.Jobs.Concurrency)
+	apiCfg.RegisterJobs(runner)
+	go func() {
+		err := apiCfg.Stream.Run(ctx, cfg.Database.URL)
+		if err != nil {
+			logger.Error("Chirp event stream stopped", "error", err)
+		}
+	}()
+
+	migrator, err := migrate.New(db)
+	if err != nil {
+		fatal("Unable to load migrations", "error", err)
+	}
+	checker := health.New(cfg.Database.PingTimeout)
+	checker.Register("database", health.PingDB(db))
+	checker.Register("migrations", migrator.CheckVersion)
+	if cfg.Features.DataExports {
+		checker.Register("export_storage", health.WritableDir(cfg.Accounts.ExportDir))
+	}
+
+	var limiterStore ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		limiterStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		pgStore := ratelimit.NewPostgresStore(apiCfg.DB)
+		runner.Register(jobPruneRateLimitBuckets, jobs.Task(pgStore.Prune))
+		runner.Schedule(jobPruneRateLimitBuckets, time.Hour)
+		limiterStore = pgStore
+	}
+	// Jobs are registered above, the runner stops claiming jobs with ctx
+	// and is waited for at shutdown.
+	jobsDone := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(jobsDone)
+	}()
+	// Webhooks are sent from a loop of their own, as running them as a job
+	// every few seconds would flood the jobs table. It is waited for at
+	// shutdown too.
+	webhooksDone := make(chan struct{})
+	go func() {
+		webhook.NewDispatcher(apiCfg.DB).Run(ctx, webhookInterval)
+		close(webhooksDone)
+	}()
+
+	limiter := ratelimit.New(limiterStore, ratelimit.KeyByUserOrIP(cfg.Auth.JWTSecret), http.HandlerFunc(handler.RateLimited))
+	limit := func(policy ratelimit.Policy, next http.Handler) http.Handler {
+		if !cfg.RateLimit.Enabled {
+			return next
+		}
+		return limiter.Limit(policy, next)
 	}
+	// Route specific policies stack on top of defaultPolicy, which applies
+	// to every request.
+	policy := func(name string, p config.RateLimitPolicy) ratelimit.Policy {
+		return ratelimit.Policy{Name: name, Burst: p.Burst, Period: p.Period}
+	}
+	defaultPolicy := policy("default", cfg.RateLimit.Default)
+	loginPolicy := policy("login", cfg.RateLimit.Login)
+	signupPolicy := policy("signup", cfg.RateLimit.Signup)
+	chirpsCreatePolicy := policy("chirps-create", cfg.RateLimit.ChirpsCreate)
+	exportPolicy := policy("export", cfg.RateLimit.Export)
+	reportPolicy := policy("report", cfg.RateLimit.Report)
+	messagePolicy := policy("message", cfg.RateLimit.Message)
 
 	mux := http.NewServeMux()
-	fsHandler := apiCfg.MiddlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("."))))
+	fsHandler := appMetrics.MiddlewareFileserverHits(http.StripPrefix("/app", http.FileServer(http.Dir("."))))
 	mux.Handle("/app/", fsHandler)
-	mux.HandleFunc("GET /api/healthz", handler.Readiness)
+	// healthz is kept for existing probes and only reports liveness.
+	mux.HandleFunc("GET /api/healthz", checker.Live)
+	mux.HandleFunc("GET /api/livez", checker.Live)
+	mux.HandleFunc("GET /api/readyz", checker.Ready)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.SubscribeUser)
 
-	mux.HandleFunc("POST /api/login", apiCfg.Login)
+	mux.Handle("POST /api/login", limit(loginPolicy, http.HandlerFunc(apiCfg.Login)))
 	mux.HandleFunc("POST /api/refresh", apiCfg.RefreshToken)
 	mux.HandleFunc("POST /api/revoke", apiCfg.RevokeToken)
 
-	mux.Handle("GET /admin/metrics", http.HandlerFunc(apiCfg.Metrics))
-	mux.Handle("POST /admin/reset", http.HandlerFunc(apiCfg.Reset))
+	if cfg.Features.PrometheusMetrics {
+		mux.Handle("GET /metrics", appMetrics.Handler())
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return apiCfg.RequireAdmin(h)
+	}
+	mux.Handle("GET /admin/metrics", admin(apiCfg.Metrics))
+	mux.Handle("POST /admin/reset", admin(apiCfg.Reset))
+	mux.Handle("GET /admin/users", admin(apiCfg.AdminListUsers))
+	mux.Handle("GET /admin/users/{userID}", admin(apiCfg.AdminGetUser))
+	mux.Handle("POST /admin/users/{userID}/suspend", admin(apiCfg.AdminSuspendUser))
+	mux.Handle("POST /admin/users/{userID}/ban", admin(apiCfg.AdminBanUser))
+	mux.Handle("POST /admin/users/{userID}/reinstate", admin(apiCfg.AdminReinstateUser))
+	mux.Handle("PUT /admin/users/{userID}/red", admin(apiCfg.AdminGrantRed))
+	mux.Handle("DELETE /admin/users/{userID}/red", admin(apiCfg.AdminRevokeRed))
+	mux.Handle("PUT /admin/users/{userID}/role", admin(apiCfg.AdminSetRole))
+	mux.Handle("GET /admin/chirps/removed", admin(apiCfg.AdminListRemovedChirps))
+	mux.Handle("DELETE /admin/chirps/{chirpID}", admin(apiCfg.AdminRemoveChirp))
+	mux.Handle("POST /admin/chirps/{chirpID}/restore", admin(apiCfg.AdminRestoreChirp))
+	mux.Handle("GET /admin/audit", admin(apiCfg.AdminListAuditEvents))
+	mux.Handle("GET /admin/reports", admin(apiCfg.AdminListReports))
+	mux.Handle("POST /admin/reports/{reportID}/claim", admin(apiCfg.AdminClaimReport))
+	mux.Handle("POST /admin/reports/{reportID}/resolve", admin(apiCfg.AdminResolveReport))
+	mux.Handle("GET /admin/jobs", admin(apiCfg.AdminListJobs))
+	mux.Handle("GET /admin/jobs/{jobID}", admin(apiCfg.AdminGetJob))
+	mux.Handle("POST /admin/jobs/{jobID}/retry", admin(apiCfg.AdminRetryJob))
+	mux.Handle("POST /admin/webhooks", admin(apiCfg.AdminCreateWebhook))
+	mux.Handle("GET /admin/webhooks", admin(apiCfg.AdminListWebhooks))
+	mux.Handle("GET /admin/webhooks/{webhookID}", admin(apiCfg.AdminGetWebhook))
+	mux.Handle("PUT /admin/webhooks/{webhookID}", admin(apiCfg.AdminUpdateWebhook))
+	mux.Handle("DELETE /admin/webhooks/{webhookID}", admin(apiCfg.AdminDeleteWebhook))
+	mux.Handle("GET /admin/webhooks/{webhookID}/deliveries", admin(apiCfg.AdminListWebhookDeliveries))
+	mux.Handle("POST /admin/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", admin(apiCfg.AdminRedeliverWebhook))
 
 	mux.HandleFunc("GET /api/chirps", apiCfg.GetChirps)
-	mux.HandleFunc("POST /api/chirps", apiCfg.ChirpsCreate)
+	mux.Handle("POST /api/chirps", limit(chirpsCreatePolicy, http.HandlerFunc(apiCfg.ChirpsCreate)))
+	mux.HandleFunc("GET /api/chirps/scheduled", apiCfg.ListScheduledChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.GetChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.DeleteChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/restore", apiCfg.RestoreChirp)
+	mux.Handle("POST /api/threads", limit(chirpsCreatePolicy, http.HandlerFunc(apiCfg.CreateThread)))
+	mux.HandleFunc("GET /api/threads/{threadID}", apiCfg.GetThread)
+	mux.HandleFunc("POST /api/drafts", apiCfg.CreateDraft)
+	mux.HandleFunc("GET /api/drafts", apiCfg.ListDrafts)
+	mux.HandleFunc("GET /api/drafts/{draftID}", apiCfg.GetDraft)
+	mux.HandleFunc("PUT /api/drafts/{draftID}", apiCfg.UpdateDraft)
+	mux.HandleFunc("DELETE /api/drafts/{draftID}", apiCfg.DeleteDraft)
+	mux.Handle("POST /api/drafts/{draftID}/publish", limit(chirpsCreatePolicy, http.HandlerFunc(apiCfg.PublishDraft)))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/votes", apiCfg.VotePoll)
+	mux.Handle("POST /api/chirps/{chirpID}/reports", limit(reportPolicy, http.HandlerFunc(apiCfg.ReportChirp)))
 
-	mux.HandleFunc("POST /api/users", apiCfg.CreateUsers)
+	mux.Handle("POST /api/users", limit(signupPolicy, http.HandlerFunc(apiCfg.CreateUsers)))
 	mux.HandleFunc("PUT /api/users", apiCfg.UpdateUsers)
+	mux.Handle("POST /api/users/{userID}/reports", limit(reportPolicy, http.HandlerFunc(apiCfg.ReportUser)))
+	mux.HandleFunc("POST /api/users/{userID}/block", apiCfg.BlockUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.UnblockUser)
+	mux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.MuteUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.UnmuteUser)
+	mux.HandleFunc("GET /api/users/me/blocks", apiCfg.ListBlockedUsers)
+	mux.HandleFunc("GET /api/users/me/mutes", apiCfg.ListMutedUsers)
+	mux.HandleFunc("PUT /api/users/me/privacy", apiCfg.SetPrivacy)
+	mux.HandleFunc("POST /api/users/{userID}/readers", apiCfg.RequestReaderAccess)
+	mux.HandleFunc("GET /api/users/me/readers", apiCfg.ListReaders)
+	mux.HandleFunc("POST /api/users/me/readers/{userID}/approve", apiCfg.ApproveReader)
+	mux.HandleFunc("POST /api/users/me/readers/{userID}/deny", apiCfg.DenyReader)
+	mux.HandleFunc("POST /api/conversations", apiCfg.StartConversation)
+	mux.HandleFunc("GET /api/conversations", apiCfg.ListConversations)
+	mux.HandleFunc("GET /api/conversations/{conversationID}", apiCfg.GetConversation)
+	mux.Handle("POST /api/conversations/{conversationID}/messages", limit(messagePolicy, http.HandlerFunc(apiCfg.SendMessage)))
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.ListMessages)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.MarkConversationRead)
+	mux.HandleFunc("GET /api/stream", apiCfg.StreamChirps)
+	mux.HandleFunc("GET /api/notifications", apiCfg.ListNotifications)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.MarkAllNotificationsRead)
+	mux.HandleFunc("POST /api/notifications/{notificationID}/read", apiCfg.MarkNotificationRead)
+	if cfg.Features.AccountDeletion {
+		mux.HandleFunc("DELETE /api/users/me", apiCfg.DeleteCurrentUser)
+	}
+	if cfg.Features.DataExports {
+		mux.Handle("POST /api/users/me/export", limit(exportPolicy, http.HandlerFunc(apiCfg.RequestDataExport)))
+		mux.HandleFunc("GET /api/users/me/exports/{exportID}", apiCfg.GetDataExport)
+		mux.HandleFunc("GET /api/users/me/exports/{exportID}/download", apiCfg.DownloadDataExport)
+	}
+
+	// Middlewares run outermost first: resolving the client address behind
+	// trusted proxies, tracing, logging, metrics, then the default rate limit
+	// and the body size cap.
+	trustedProxies, err := cfg.Server.TrustedProxyPrefixes()
+	if err != nil {
+		fatal("Invalid trusted proxies", "error", err)
+	}
+	// Health probes skip the default rate limit, load balancers polling them
+	// from a handful of addresses.
+	probes := []string{"GET /api/healthz", "GET /api/livez", "GET /api/readyz"}
+	bodyLimited := httpx.LimitBody(cfg.Server.MaxBodyBytes, mux)
+	rateLimited := limit(defaultPolicy, bodyLimited)
+	var root http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(probes, httpx.Route(mux, r)) {
+			bodyLimited.ServeHTTP(w, r)
+			return
+		}
+		rateLimited.ServeHTTP(w, r)
+	})
+	root = appMetrics.Middleware(mux, root)
+	root = logging.Middleware(logger, mux, root)
+	root = tracing.Middleware(mux, root)
+	root = httpx.TrustProxies(trustedProxies, root)
 
 	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:              cfg.Server.ListenAddr,
+		Handler:           root,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Info("Serving Chirpy", "addr", server.Addr, "tls", cfg.Server.TLSCertFile != "")
+		if cfg.Server.TLSCertFile != "" {
+			serveErr <- server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+			return
+		}
+		serveErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server stopped", "error", err)
+		}
+	case <-ctx.Done():
+		stop()
+		checker.Drain()
+		logger.Info("Shutting down, draining in-flight requests", "drain_delay", cfg.Server.DrainDelay)
+		// Keep serving while load balancers notice readiness failing.
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelShutdown()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		logger.Error("Error shutting down server", "error", err)
+	}
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("Jobs still running at shutdown, they will be retried once their lease runs out")
 	}
-	server.ListenAndServe()
+	select {
+	case <-webhooksDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("Webhook delivery still running at shutdown, it will be retried once its lease runs out")
+	}
+	err = shutdownTracing(shutdownCtx)
+	if err != nil {
+		logger.Error("Error flushing traces", "error", err)
+	}
+	err = db.Close()
+	if err != nil {
+		logger.Error("Error closing db", "error", err)
+	}
+	logger.Info("Chirpy stopped")
+}
+
+// openDB opens the connection pool and checks the database is reachable.
+// hooks run around every query made on its connections, transactions
+// included.
+func openDB(ctx context.Context, cfg config.DatabaseConfig, hooks ...dbtx.Hook) (*sql.DB, error) {
+	connector, err := pq.NewConnector(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(dbtx.Connector(connector, hooks...))
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	pingCtx, cancelPing := context.WithTimeout(ctx, cfg.PingTimeout)
+	defer cancelPing()
+	err = db.PingContext(pingCtx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
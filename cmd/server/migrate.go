@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/finchrelia/chirpy-server/internal/config"
+	"github.com/finchrelia/chirpy-server/internal/migrate"
+	"github.com/pressly/goose/v3"
+)
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, cfg config.Config, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: migrate up|down|status|redo")
+		os.Exit(2)
+	}
+	db, err := openDB(ctx, cfg.Database)
+	if err != nil {
+		fatal("Unable to reach db, check DB_URL", "error", err)
+	}
+	defer db.Close()
+	migrator, err := migrate.New(db)
+	if err != nil {
+		fatal("Unable to load migrations", "error", err)
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrateUp(ctx, db)
+	case "down":
+		var result *goose.MigrationResult
+		result, err = migrator.Down(ctx)
+		if result != nil {
+			logMigration(result)
+		}
+	case "redo":
+		var results []*goose.MigrationResult
+		results, err = migrator.Redo(ctx)
+		for _, result := range results {
+			logMigration(result)
+		}
+	case "status":
+		err = migrator.Status(ctx, os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown migrate command %q, must be up, down, status or redo\n", args[0])
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal("Migration failed", "command", args[0], "error", err)
+	}
+}
+
+// migrateUp applies every pending migration and logs the resulting version.
+func migrateUp(ctx context.Context, db *sql.DB) error {
+	migrator, err := migrate.New(db)
+	if err != nil {
+		return err
+	}
+	results, err := migrator.Up(ctx)
+	for _, result := range results {
+		logMigration(result)
+	}
+	if err != nil {
+		return err
+	}
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("Database schema up to date", "version", version, "applied", len(results))
+	return nil
+}
+
+func logMigration(result *goose.MigrationResult) {
+	slog.Info("Applied migration",
+		"version", result.Source.Version,
+		"file", result.Source.Path,
+		"direction", result.Direction,
+		"duration", result.Duration,
+	)
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/httpx"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionUserSuspend   = "user.suspend"
+	ActionUserBan       = "user.ban"
+	ActionUserReinstate = "user.reinstate"
+	ActionUserGrantRed  = "user.grant_red"
+	ActionUserRevokeRed = "user.revoke_red"
+	ActionUserSetRole   = "user.set_role"
+	ActionChirpRemove   = "chirp.remove"
+	ActionReset         = "admin.reset"
+
+	ActionLoginSuccess     = "login.success"
+	ActionLoginFailure     = "login.failure"
+	ActionTokenRefresh     = "token.refresh"
+	ActionTokenRevoke      = "token.revoke"
+	ActionUserCredentials  = "user.update_credentials"
+	ActionChirpDelete      = "chirp.delete"
+	ActionChirpRestore     = "chirp.restore"
+	ActionUserUpgradePolka = "user.upgrade_red"
+	ActionUserDelete       = "user.delete"
+
+	ActionChirpAutoHide = "chirp.auto_hide"
+	ActionReportClaim   = "report.claim"
+	ActionReportResolve = "report.resolve"
+
+	ActionWebhookCreate    = "webhook.create"
+	ActionWebhookUpdate    = "webhook.update"
+	ActionWebhookDelete    = "webhook.delete"
+	ActionWebhookRedeliver = "webhook.redeliver"
+
+	ActionJobRetry = "job.retry"
+)
+
+// Kinds of audit targets.
+const (
+	TargetUser    = "user"
+	TargetChirp   = "chirp"
+	TargetSystem  = "system"
+	TargetReport  = "report"
+	TargetWebhook = "webhook"
+	TargetJob     = "job"
+)
+
+// Event is a security relevant action. ActorID is unset when nobody could be
+// authenticated, such as failed logins, Polka webhooks or commands run by an
+// operator.
+type Event struct {
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   uuid.NullUUID
+	Details    map[string]any
+	IP         string
+	UserAgent  string
+	RequestID  string
+}
+
+// WithRequest returns event with the client IP, user agent and request ID of
+// r filled in.
+func WithRequest(r *http.Request, event Event) Event {
+	event.IP = httpx.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+	event.RequestID = logging.RequestID(r.Context())
+	return event
+}
+
+// Record writes event to the audit log. Pass the queries of the transaction
+// making the change, so it is only recorded if the change commits.
+func Record(ctx context.Context, db *database.Queries, event Event) error {
+	details := event.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = db.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Details:    data,
+		Ip:         event.IP,
+		UserAgent:  event.UserAgent,
+		RequestID:  event.RequestID,
+	})
+	return err
+}
+
+// NullID returns id as a set ActorID or TargetID.
+func NullID(id uuid.UUID) uuid.NullUUID {
+	return uuid.NullUUID{UUID: id, Valid: true}
+}
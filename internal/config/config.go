@@ -0,0 +1,517 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting of the server. Values come from, in increasing
+// order of precedence: the defaults below, the optional YAML or TOML config
+// file, and environment variables (including those loaded from .env). Each
+// field names its variable in its env tag; secret fields are redacted when
+// printed.
+type Config struct {
+	Platform  string          `yaml:"platform" toml:"platform" env:"PLATFORM"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	Chirps    ChirpsConfig    `yaml:"chirps" toml:"chirps"`
+	Accounts  AccountsConfig  `yaml:"accounts" toml:"accounts"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Audit     AuditConfig     `yaml:"audit" toml:"audit"`
+	Reports   ReportsConfig   `yaml:"reports" toml:"reports"`
+	Jobs      JobsConfig      `yaml:"jobs" toml:"jobs"`
+	Features  FeaturesConfig  `yaml:"features" toml:"features"`
+}
+
+type ServerConfig struct {
+	ListenAddr        string        `yaml:"listen_addr" toml:"listen_addr" env:"LISTEN_ADDR"`
+	TLSCertFile       string        `yaml:"tls_cert_file" toml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" toml:"tls_key_file" env:"TLS_KEY_FILE"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	DrainDelay        time.Duration `yaml:"drain_delay" toml:"drain_delay" env:"DRAIN_DELAY"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"MAX_HEADER_BYTES"`
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" toml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+	// TrustedProxies lists the CIDRs (or addresses) of the load balancers
+	// and proxies in front of the server. The client address is taken from
+	// X-Forwarded-For on requests coming through them.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, a bare address standing for
+// itself alone.
+func (c ServerConfig) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, proxy := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CIDR or an IP address", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" toml:"url" env:"DB_URL" secret:"true"`
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	PingTimeout     time.Duration `yaml:"ping_timeout" toml:"ping_timeout" env:"DB_PING_TIMEOUT"`
+	MigrateOnStart  bool          `yaml:"migrate_on_start" toml:"migrate_on_start" env:"MIGRATE_ON_START"`
+}
+
+type AuthConfig struct {
+	JWTSecret       string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	PolkaKey        string        `yaml:"polka_key" toml:"polka_key" env:"POLKA_KEY" secret:"true"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+}
+
+type ChirpsConfig struct {
+	MaxLength   int      `yaml:"max_length" toml:"max_length" env:"CHIRP_MAX_LENGTH"`
+	BannedWords []string `yaml:"banned_words" toml:"banned_words" env:"CHIRP_BANNED_WORDS"`
+	// UndeleteWindow is how long owners can restore a chirp they deleted.
+	UndeleteWindow time.Duration `yaml:"undelete_window" toml:"undelete_window" env:"CHIRP_UNDELETE_WINDOW"`
+	// DeletedRetention is how long deleted chirps are kept before being
+	// purged for good.
+	DeletedRetention time.Duration `yaml:"deleted_retention" toml:"deleted_retention" env:"CHIRP_DELETED_RETENTION"`
+}
+
+type AccountsConfig struct {
+	DeletionGracePeriod time.Duration `yaml:"deletion_grace_period" toml:"deletion_grace_period" env:"ACCOUNT_DELETION_GRACE_PERIOD"`
+	ExportDir           string        `yaml:"export_dir" toml:"export_dir" env:"EXPORT_DIR"`
+	// ExportTTL is how long export archives can be downloaded before they
+	// are deleted.
+	ExportTTL time.Duration `yaml:"export_ttl" toml:"export_ttl" env:"EXPORT_TTL"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
+
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint string `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Store   string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE"`
+	// Default applies to every request, the others stack on top of it for
+	// their routes.
+	Default      RateLimitPolicy `yaml:"default" toml:"default" env:"RATE_LIMIT_DEFAULT"`
+	Login        RateLimitPolicy `yaml:"login" toml:"login" env:"RATE_LIMIT_LOGIN"`
+	Signup       RateLimitPolicy `yaml:"signup" toml:"signup" env:"RATE_LIMIT_SIGNUP"`
+	ChirpsCreate RateLimitPolicy `yaml:"chirps_create" toml:"chirps_create" env:"RATE_LIMIT_CHIRPS_CREATE"`
+	Export       RateLimitPolicy `yaml:"export" toml:"export" env:"RATE_LIMIT_EXPORT"`
+	Report       RateLimitPolicy `yaml:"report" toml:"report" env:"RATE_LIMIT_REPORT"`
+	Message      RateLimitPolicy `yaml:"message" toml:"message" env:"RATE_LIMIT_MESSAGE"`
+}
+
+// RateLimitPolicy allows Burst requests at once, refilled over Period. It is
+// written as "burst/period", such as "5/1m".
+type RateLimitPolicy struct {
+	Burst  int
+	Period time.Duration
+}
+
+func (p RateLimitPolicy) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d/%s", p.Burst, p.Period)), nil
+}
+
+func (p *RateLimitPolicy) UnmarshalText(text []byte) error {
+	burst, period, ok := strings.Cut(string(text), "/")
+	if !ok {
+		return fmt.Errorf("rate limit %q must be written burst/period, such as 5/1m", text)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(burst))
+	if err != nil {
+		return fmt.Errorf("rate limit %q: invalid burst: %w", text, err)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil {
+		return fmt.Errorf("rate limit %q: invalid period: %w", text, err)
+	}
+	p.Burst = n
+	p.Period = d
+	return nil
+}
+
+type AuditConfig struct {
+	Retention time.Duration `yaml:"retention" toml:"retention" env:"AUDIT_RETENTION"`
+}
+
+type ReportsConfig struct {
+	// HideThreshold is how many users must report a chirp for it to be
+	// hidden until reviewed, 0 to disable.
+	HideThreshold int `yaml:"hide_threshold" toml:"hide_threshold" env:"REPORT_HIDE_THRESHOLD"`
+}
+
+type JobsConfig struct {
+	// Concurrency is how many background jobs each replica runs at once.
+	Concurrency int `yaml:"concurrency" toml:"concurrency" env:"JOBS_CONCURRENCY"`
+}
+
+type FeaturesConfig struct {
+	DataExports       bool `yaml:"data_exports" toml:"data_exports" env:"FEATURE_DATA_EXPORTS"`
+	AccountDeletion   bool `yaml:"account_deletion" toml:"account_deletion" env:"FEATURE_ACCOUNT_DELETION"`
+	PrometheusMetrics bool `yaml:"prometheus_metrics" toml:"prometheus_metrics" env:"FEATURE_PROMETHEUS_METRICS"`
+}
+
+// Default returns the configuration used for anything left unset.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ListenAddr:        ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			DrainDelay:        5 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			PingTimeout:     5 * time.Second,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 60 * 24 * time.Hour,
+		},
+		Chirps: ChirpsConfig{
+			MaxLength:        140,
+			BannedWords:      []string{"kerfuffle", "sharbert", "fornax"},
+			UndeleteWindow:   24 * time.Hour,
+			DeletedRetention: 30 * 24 * time.Hour,
+		},
+		Accounts: AccountsConfig{
+			DeletionGracePeriod: 30 * 24 * time.Hour,
+			ExportDir:           "exports",
+			ExportTTL:           7 * 24 * time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Exporter: "none",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:      true,
+			Store:        "memory",
+			Default:      RateLimitPolicy{Burst: 120, Period: time.Minute},
+			Login:        RateLimitPolicy{Burst: 5, Period: time.Minute},
+			Signup:       RateLimitPolicy{Burst: 5, Period: time.Hour},
+			ChirpsCreate: RateLimitPolicy{Burst: 30, Period: time.Minute},
+			Export:       RateLimitPolicy{Burst: 2, Period: 24 * time.Hour},
+			Report:       RateLimitPolicy{Burst: 20, Period: time.Hour},
+			Message:      RateLimitPolicy{Burst: 60, Period: time.Minute},
+		},
+		Audit: AuditConfig{
+			Retention: 365 * 24 * time.Hour,
+		},
+		Reports: ReportsConfig{
+			HideThreshold: 3,
+		},
+		Jobs: JobsConfig{
+			Concurrency: 4,
+		},
+		Features: FeaturesConfig{
+			DataExports:       true,
+			AccountDeletion:   true,
+			PrometheusMetrics: true,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the config file at path
+// (skipped when empty) and the environment. It does not validate it, see
+// Validate. Values that can't be read are reported in the returned error,
+// the configuration being returned with everything else applied so it can
+// still be printed.
+func Load(path string) (Config, error) {
+	// A missing .env file is fine, the variables may come from elsewhere.
+	godotenv.Load()
+
+	cfg := Default()
+	var fileErr error
+	if path != "" {
+		fileErr = loadFile(path, &cfg)
+	}
+	return cfg, errors.Join(fileErr, loadEnv(reflect.ValueOf(&cfg).Elem()))
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), cfg)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown keys %v", meta.Undecoded())
+		}
+	default:
+		return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides every field carrying an env tag whose variable is set.
+func loadEnv(v reflect.Value) error {
+	var errs []error
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		fieldType := v.Type().Field(i)
+		_, isText := field.Addr().Interface().(encoding.TextUnmarshaler)
+		if field.Kind() == reflect.Struct && !isText {
+			errs = append(errs, loadEnv(field))
+			continue
+		}
+		name := fieldType.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		err := setField(field, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setField(field reflect.Value, value string) error {
+	if text, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return text.UnmarshalText([]byte(value))
+	}
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case string:
+		field.SetString(value)
+	case int, int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case []string:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once.
+func (c Config) Validate() error {
+	var errs []error
+	required := map[string]string{
+		"PLATFORM":   c.Platform,
+		"DB_URL":     c.Database.URL,
+		"JWT_SECRET": c.Auth.JWTSecret,
+		"POLKA_KEY":  c.Auth.PolkaKey,
+	}
+	for _, name := range []string{"PLATFORM", "DB_URL", "JWT_SECRET", "POLKA_KEY"} {
+		if required[name] == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	if c.Server.ListenAddr == "" {
+		errs = append(errs, errors.New("LISTEN_ADDR is required"))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+	for _, file := range []string{c.Server.TLSCertFile, c.Server.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("TLS file: %w", err))
+		}
+	}
+
+	positive := []struct {
+		name  string
+		value int64
+	}{
+		{"READ_HEADER_TIMEOUT", int64(c.Server.ReadHeaderTimeout)},
+		{"READ_TIMEOUT", int64(c.Server.ReadTimeout)},
+		{"WRITE_TIMEOUT", int64(c.Server.WriteTimeout)},
+		{"IDLE_TIMEOUT", int64(c.Server.IdleTimeout)},
+		{"SHUTDOWN_TIMEOUT", int64(c.Server.ShutdownTimeout)},
+		{"MAX_HEADER_BYTES", int64(c.Server.MaxHeaderBytes)},
+		{"MAX_BODY_BYTES", c.Server.MaxBodyBytes},
+		{"DB_MAX_OPEN_CONNS", int64(c.Database.MaxOpenConns)},
+		{"DB_MAX_IDLE_CONNS", int64(c.Database.MaxIdleConns)},
+		{"DB_CONN_MAX_LIFETIME", int64(c.Database.ConnMaxLifetime)},
+		{"DB_CONN_MAX_IDLE_TIME", int64(c.Database.ConnMaxIdleTime)},
+		{"DB_PING_TIMEOUT", int64(c.Database.PingTimeout)},
+		{"ACCESS_TOKEN_TTL", int64(c.Auth.AccessTokenTTL)},
+		{"REFRESH_TOKEN_TTL", int64(c.Auth.RefreshTokenTTL)},
+		{"CHIRP_MAX_LENGTH", int64(c.Chirps.MaxLength)},
+		{"CHIRP_UNDELETE_WINDOW", int64(c.Chirps.UndeleteWindow)},
+		{"CHIRP_DELETED_RETENTION", int64(c.Chirps.DeletedRetention)},
+		{"ACCOUNT_DELETION_GRACE_PERIOD", int64(c.Accounts.DeletionGracePeriod)},
+		{"EXPORT_TTL", int64(c.Accounts.ExportTTL)},
+		{"AUDIT_RETENTION", int64(c.Audit.Retention)},
+		{"JOBS_CONCURRENCY", int64(c.Jobs.Concurrency)},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", p.name))
+		}
+	}
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("DRAIN_DELAY must not be negative"))
+	}
+	if c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS"))
+	}
+	if c.Auth.RefreshTokenTTL < c.Auth.AccessTokenTTL {
+		errs = append(errs, errors.New("REFRESH_TOKEN_TTL must not be shorter than ACCESS_TOKEN_TTL"))
+	}
+	if c.Reports.HideThreshold < 0 {
+		errs = append(errs, errors.New("REPORT_HIDE_THRESHOLD must not be negative"))
+	}
+	if c.Chirps.DeletedRetention < c.Chirps.UndeleteWindow {
+		errs = append(errs, errors.New("CHIRP_DELETED_RETENTION must not be shorter than CHIRP_UNDELETE_WINDOW"))
+	}
+	if _, err := c.Server.TrustedProxyPrefixes(); err != nil {
+		errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %w", err))
+	}
+	policies := []struct {
+		name   string
+		policy RateLimitPolicy
+	}{
+		{"RATE_LIMIT_DEFAULT", c.RateLimit.Default},
+		{"RATE_LIMIT_LOGIN", c.RateLimit.Login},
+		{"RATE_LIMIT_SIGNUP", c.RateLimit.Signup},
+		{"RATE_LIMIT_CHIRPS_CREATE", c.RateLimit.ChirpsCreate},
+		{"RATE_LIMIT_EXPORT", c.RateLimit.Export},
+		{"RATE_LIMIT_REPORT", c.RateLimit.Report},
+		{"RATE_LIMIT_MESSAGE", c.RateLimit.Message},
+	}
+	for _, p := range policies {
+		if p.policy.Burst <= 0 || p.policy.Period <= 0 {
+			errs = append(errs, fmt.Errorf("%s must have a positive burst and period", p.name))
+		}
+	}
+	if c.Features.DataExports && c.Accounts.ExportDir == "" {
+		errs = append(errs, errors.New("EXPORT_DIR is required when data exports are enabled"))
+	}
+
+	oneOf := []struct {
+		name    string
+		value   string
+		allowed []string
+	}{
+		{"LOG_LEVEL", strings.ToLower(c.Log.Level), []string{"debug", "info", "warn", "error"}},
+		{"LOG_FORMAT", strings.ToLower(c.Log.Format), []string{"json", "text"}},
+		{"TRACING_EXPORTER", c.Tracing.Exporter, []string{"none", "stdout", "otlp"}},
+		{"RATE_LIMIT_STORE", c.RateLimit.Store, []string{"memory", "postgres"}},
+	}
+	for _, o := range oneOf {
+		if !contains(o.allowed, o.value) {
+			errs = append(errs, fmt.Errorf("%s must be one of %s, got %q", o.name, strings.Join(o.allowed, ", "), o.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of c with every secret field masked, safe to print.
+func (c Config) Redacted() Config {
+	redactSecrets(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+func redactSecrets(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			redactSecrets(field)
+			continue
+		}
+		if v.Type().Field(i).Tag.Get("secret") == "true" && field.String() != "" {
+			field.SetString("REDACTED")
+		}
+	}
+}
+
+// YAML renders c in the config file format.
+func (c Config) YAML() (string, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
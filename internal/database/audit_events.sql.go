@@ -0,0 +1,150 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: audit_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events (id, created_at, actor_id, action, target_type, target_id, details, ip, user_agent, request_id)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING id, created_at, actor_id, action, target_type, target_id, details, ip, user_agent, request_id
+`
+
+type CreateAuditEventParams struct {
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   uuid.NullUUID
+	Details    json.RawMessage
+	Ip         string
+	UserAgent  string
+	RequestID  string
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.ActorID,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		arg.Details,
+		arg.Ip,
+		arg.UserAgent,
+		arg.RequestID,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.ActorID,
+		&i.Action,
+		&i.TargetType,
+		&i.TargetID,
+		&i.Details,
+		&i.Ip,
+		&i.UserAgent,
+		&i.RequestID,
+	)
+	return i, err
+}
+
+const listAuditEvents = `-- name: ListAuditEvents :many
+SELECT id, created_at, actor_id, action, target_type, target_id, details, ip, user_agent, request_id FROM audit_events
+WHERE ($1::uuid IS NULL OR actor_id = $1::uuid)
+AND ($2::uuid IS NULL OR target_id = $2::uuid)
+AND ($3::text IS NULL OR action = $3::text)
+AND ($4::text IS NULL OR target_type = $4::text)
+AND ($5::timestamp IS NULL OR created_at >= $5::timestamp)
+AND ($6::timestamp IS NULL OR created_at < $6::timestamp)
+ORDER BY created_at DESC
+LIMIT $8
+OFFSET $7
+`
+
+type ListAuditEventsParams struct {
+	ActorID    uuid.NullUUID
+	TargetID   uuid.NullUUID
+	Action     sql.NullString
+	TargetType sql.NullString
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Offset     int32
+	Limit      int32
+}
+
+func (q *Queries) ListAuditEvents(ctx context.Context, arg ListAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditEvents,
+		arg.ActorID,
+		arg.TargetID,
+		arg.Action,
+		arg.TargetType,
+		arg.Since,
+		arg.Until,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ActorID,
+			&i.Action,
+			&i.TargetType,
+			&i.TargetID,
+			&i.Details,
+			&i.Ip,
+			&i.UserAgent,
+			&i.RequestID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pruneAuditEvents = `-- name: PruneAuditEvents :execrows
+DELETE FROM audit_events
+WHERE created_at < $1
+`
+
+func (q *Queries) PruneAuditEvents(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneAuditEvents, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
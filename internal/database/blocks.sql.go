@@ -0,0 +1,188 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: blocks.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const blockUser = `-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING
+`
+
+type BlockUserParams struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+}
+
+func (q *Queries) BlockUser(ctx context.Context, arg BlockUserParams) error {
+	_, err := q.db.ExecContext(ctx, blockUser, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
+const isBlockedBetween = `-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $1 AND blocked_id = $2)
+    OR (blocker_id = $2 AND blocked_id = $1)
+)
+`
+
+type IsBlockedBetweenParams struct {
+	UserA uuid.UUID
+	UserB uuid.UUID
+}
+
+func (q *Queries) IsBlockedBetween(ctx context.Context, arg IsBlockedBetweenParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isBlockedBetween, arg.UserA, arg.UserB)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listBlockedUsers = `-- name: ListBlockedUsers :many
+SELECT blocker_id, blocked_id, created_at FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]UserBlock, error) {
+	rows, err := q.db.QueryContext(ctx, listBlockedUsers, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserBlock
+	for rows.Next() {
+		var i UserBlock
+		if err := rows.Scan(&i.BlockerID, &i.BlockedID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHiddenAuthors = `-- name: ListHiddenAuthors :many
+
+SELECT b1.blocked_id AS user_id FROM user_blocks b1 WHERE b1.blocker_id = $1
+UNION
+SELECT b2.blocker_id AS user_id FROM user_blocks b2 WHERE b2.blocked_id = $1
+UNION
+SELECT m.muted_id AS user_id FROM user_mutes m WHERE m.muter_id = $1
+`
+
+// Authors whose chirps a user's listings leave out: those they blocked, were
+// blocked by or muted.
+func (q *Queries) ListHiddenAuthors(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listHiddenAuthors, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMutedUsers = `-- name: ListMutedUsers :many
+SELECT muter_id, muted_id, created_at FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListMutedUsers(ctx context.Context, muterID uuid.UUID) ([]UserMute, error) {
+	rows, err := q.db.QueryContext(ctx, listMutedUsers, muterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UserMute
+	for rows.Next() {
+		var i UserMute
+		if err := rows.Scan(&i.MuterID, &i.MutedID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const muteUser = `-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING
+`
+
+type MuteUserParams struct {
+	MuterID uuid.UUID
+	MutedID uuid.UUID
+}
+
+func (q *Queries) MuteUser(ctx context.Context, arg MuteUserParams) error {
+	_, err := q.db.ExecContext(ctx, muteUser, arg.MuterID, arg.MutedID)
+	return err
+}
+
+const unblockUser = `-- name: UnblockUser :exec
+DELETE FROM user_blocks
+WHERE blocker_id = $1
+AND blocked_id = $2
+`
+
+type UnblockUserParams struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+}
+
+func (q *Queries) UnblockUser(ctx context.Context, arg UnblockUserParams) error {
+	_, err := q.db.ExecContext(ctx, unblockUser, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
+const unmuteUser = `-- name: UnmuteUser :exec
+DELETE FROM user_mutes
+WHERE muter_id = $1
+AND muted_id = $2
+`
+
+type UnmuteUserParams struct {
+	MuterID uuid.UUID
+	MutedID uuid.UUID
+}
+
+func (q *Queries) UnmuteUser(ctx context.Context, arg UnmuteUserParams) error {
+	_, err := q.db.ExecContext(ctx, unmuteUser, arg.MuterID, arg.MutedID)
+	return err
+}
@@ -0,0 +1,159 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: chirp_events.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const canViewChirp = `-- name: CanViewChirp :one
+SELECT chirp_visible_to($1, $2, $3)
+`
+
+type CanViewChirpParams struct {
+	AuthorID   uuid.UUID
+	Visibility string
+	ViewerID   uuid.UUID
+}
+
+func (q *Queries) CanViewChirp(ctx context.Context, arg CanViewChirpParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, canViewChirp, arg.AuthorID, arg.Visibility, arg.ViewerID)
+	var chirp_visible_to bool
+	err := row.Scan(&chirp_visible_to)
+	return chirp_visible_to, err
+}
+
+const getChirpEvent = `-- name: GetChirpEvent :one
+SELECT chirp_events.position::bigint AS id, chirp_events.type, chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.deleted_at, chirps.deleted_by, chirps.deletion_reason, chirps.hidden_at, chirps.visibility, chirps.publish_at, chirps.published_at, chirps.reply_to_id, chirps.thread_id, chirps.thread_position, users.is_protected AS author_protected
+FROM chirp_events
+JOIN chirps ON chirps.id = chirp_events.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_events.position = $1::bigint
+`
+
+type GetChirpEventRow struct {
+	ID              int64
+	Type            string
+	Chirp           Chirp
+	AuthorProtected bool
+}
+
+func (q *Queries) GetChirpEvent(ctx context.Context, id int64) (GetChirpEventRow, error) {
+	row := q.db.QueryRowContext(ctx, getChirpEvent, id)
+	var i GetChirpEventRow
+	err := row.Scan(
+		&i.ID,
+		&i.Type,
+		&i.Chirp.ID,
+		&i.Chirp.CreatedAt,
+		&i.Chirp.UpdatedAt,
+		&i.Chirp.Body,
+		&i.Chirp.UserID,
+		&i.Chirp.DeletedAt,
+		&i.Chirp.DeletedBy,
+		&i.Chirp.DeletionReason,
+		&i.Chirp.HiddenAt,
+		&i.Chirp.Visibility,
+		&i.Chirp.PublishAt,
+		&i.Chirp.PublishedAt,
+		&i.Chirp.ReplyToID,
+		&i.Chirp.ThreadID,
+		&i.Chirp.ThreadPosition,
+		&i.AuthorProtected,
+	)
+	return i, err
+}
+
+const getLatestChirpEventID = `-- name: GetLatestChirpEventID :one
+SELECT COALESCE(MAX(position), 0)::bigint FROM chirp_events
+`
+
+func (q *Queries) GetLatestChirpEventID(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLatestChirpEventID)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const listChirpEventsAfter = `-- name: ListChirpEventsAfter :many
+SELECT chirp_events.position::bigint AS id, chirp_events.type, chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.deleted_at, chirps.deleted_by, chirps.deletion_reason, chirps.hidden_at, chirps.visibility, chirps.publish_at, chirps.published_at, chirps.reply_to_id, chirps.thread_id, chirps.thread_position, users.is_protected AS author_protected
+FROM chirp_events
+JOIN chirps ON chirps.id = chirp_events.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_events.position > $1::bigint
+ORDER BY chirp_events.position ASC
+LIMIT $2
+`
+
+type ListChirpEventsAfterParams struct {
+	ID    int64
+	Limit int32
+}
+
+type ListChirpEventsAfterRow struct {
+	ID              int64
+	Type            string
+	Chirp           Chirp
+	AuthorProtected bool
+}
+
+func (q *Queries) ListChirpEventsAfter(ctx context.Context, arg ListChirpEventsAfterParams) ([]ListChirpEventsAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpEventsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpEventsAfterRow
+	for rows.Next() {
+		var i ListChirpEventsAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Type,
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.DeletedBy,
+			&i.Chirp.DeletionReason,
+			&i.Chirp.HiddenAt,
+			&i.Chirp.Visibility,
+			&i.Chirp.PublishAt,
+			&i.Chirp.PublishedAt,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.ThreadID,
+			&i.Chirp.ThreadPosition,
+			&i.AuthorProtected,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pruneChirpEvents = `-- name: PruneChirpEvents :execrows
+DELETE FROM chirp_events
+WHERE created_at < $1
+`
+
+func (q *Queries) PruneChirpEvents(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneChirpEvents, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
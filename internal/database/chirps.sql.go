@@ -7,29 +7,52 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4::timestamp,
+    CASE WHEN $4::timestamp IS NULL THEN NOW() END,
+    $5::uuid,
+    $6::uuid,
+    $7::integer
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body           string
+	UserID         uuid.UUID
+	Visibility     string
+	PublishAt      sql.NullTime
+	ReplyToID      uuid.NullUUID
+	ThreadID       uuid.NullUUID
+	ThreadPosition sql.NullInt32
 }
 
+// CreateChirp publishes the chirp right away unless it has a publish_at.
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.Visibility,
+		arg.PublishAt,
+		arg.ReplyToID,
+		arg.ThreadID,
+		arg.ThreadPosition,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,33 +60,183 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps
-WHERE id = $1
-AND user_id = $2
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE chirps.id = $1
+AND deleted_at IS NULL
 `
 
-type DeleteChirpParams struct {
-	ID     uuid.UUID
-	UserID uuid.UUID
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
 }
 
-func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, arg.ID, arg.UserID)
-	return err
+const getChirps = `-- name: GetChirps :many
+
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, $1::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $1::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = $1::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = $1::uuid
+    AND muted_id = chirps.user_id
+)
+ORDER BY published_at ASC
+`
+
+// Chirp reads take the viewer, if signed in, to only return chirps they may
+// see and, in listings, leave out chirps from users they blocked, were
+// blocked by or muted.
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+const getChirpsByUserid = `-- name: GetChirpsByUserid :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE chirps.user_id = $1
+AND deleted_at IS NULL
+AND hidden_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, $2::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $2::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = $2::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = $2::uuid
+    AND muted_id = chirps.user_id
+)
+ORDER BY published_at ASC
+`
+
+type GetChirpsByUseridParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+func (q *Queries) GetChirpsByUserid(ctx context.Context, arg GetChirpsByUseridParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserid, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedChirp = `-- name: GetDeletedChirp :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
 WHERE chirps.id = $1
+AND deleted_at IS NOT NULL
 `
 
-func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirp, id)
+func (q *Queries) GetDeletedChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getDeletedChirp, id)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -71,17 +244,29 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
 	)
 	return i, err
 }
 
-const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+const getOwnChirps = `-- name: GetOwnChirps :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE chirps.user_id = $1
+AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetOwnChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getOwnChirps, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +280,16 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
 		); err != nil {
 			return nil, err
 		}
@@ -109,13 +304,290 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpsByUserid = `-- name: GetChirpsByUserid :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+const getReadableChirp = `-- name: GetReadableChirp :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE chirps.id = $1
+AND deleted_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, $2::uuid)
+`
+
+type GetReadableChirpParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+func (q *Queries) GetReadableChirp(ctx context.Context, arg GetReadableChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getReadableChirp, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
+}
+
+const getVisibleChirp = `-- name: GetVisibleChirp :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE chirps.id = $1
+AND deleted_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, $2::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $2::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = $2::uuid)
+)
+`
+
+type GetVisibleChirpParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+func (q *Queries) GetVisibleChirp(ctx context.Context, arg GetVisibleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getVisibleChirp, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
+}
+
+const hideChirp = `-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1
+AND hidden_at IS NULL
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, hideChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listDeletedChirps = `-- name: ListDeletedChirps :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE deleted_at IS NOT NULL
+AND ($1::text IS NULL OR deletion_reason = $1::text)
+AND ($2::uuid IS NULL OR user_id = $2::uuid)
+ORDER BY deleted_at DESC
+LIMIT $4
+OFFSET $3
+`
+
+type ListDeletedChirpsParams struct {
+	Reason   sql.NullString
+	AuthorID uuid.NullUUID
+	Offset   int32
+	Limit    int32
+}
+
+func (q *Queries) ListDeletedChirps(ctx context.Context, arg ListDeletedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listDeletedChirps,
+		arg.Reason,
+		arg.AuthorID,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScheduledChirps = `-- name: ListScheduledChirps :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
 WHERE chirps.user_id = $1
+AND published_at IS NULL
+AND deleted_at IS NULL
+ORDER BY publish_at ASC
+`
+
+func (q *Queries) ListScheduledChirps(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listThreadChirps = `-- name: ListThreadChirps :many
+
+SELECT id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position FROM chirps
+WHERE chirps.thread_id = $1
+AND deleted_at IS NULL
+AND hidden_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, $2::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = $2::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = $2::uuid)
+)
+ORDER BY thread_position ASC
+`
+
+type ListThreadChirpsParams struct {
+	ThreadID uuid.NullUUID
+	ViewerID uuid.NullUUID
+}
+
+// ListThreadChirps returns the chirps of a thread the viewer may see, in
+// order. They share an author, so either all or none of them are returned
+// besides deleted or hidden ones.
+func (q *Queries) ListThreadChirps(ctx context.Context, arg ListThreadChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listThreadChirps, arg.ThreadID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+
+UPDATE chirps
+SET published_at = NOW(),
+updated_at = NOW()
+WHERE chirps.id IN (
+    SELECT due.id FROM chirps due
+    WHERE due.published_at IS NULL
+    AND due.deleted_at IS NULL
+    AND due.publish_at <= NOW()
+    ORDER BY due.publish_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position
 `
 
-func (q *Queries) GetChirpsByUserid(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUserid, userID)
+// PublishDueChirps publishes a batch of the scheduled chirps whose time has
+// come.
+func (q *Queries) PublishDueChirps(ctx context.Context, limit int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +601,16 @@ func (q *Queries) GetChirpsByUserid(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.DeletionReason,
+			&i.HiddenAt,
+			&i.Visibility,
+			&i.PublishAt,
+			&i.PublishedAt,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.ThreadPosition,
 		); err != nil {
 			return nil, err
 		}
@@ -142,3 +624,174 @@ func (q *Queries) GetChirpsByUserid(ctx context.Context, userID uuid.UUID) ([]Ch
 	}
 	return items, nil
 }
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at IS NOT NULL
+AND deleted_at < $1::timestamp
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const reclassifyChirpDeletion = `-- name: ReclassifyChirpDeletion :one
+UPDATE chirps
+SET deleted_by = $2,
+deletion_reason = $3,
+updated_at = NOW()
+WHERE id = $1
+AND deletion_reason = 'owner'
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position
+`
+
+type ReclassifyChirpDeletionParams struct {
+	ID             uuid.UUID
+	DeletedBy      uuid.NullUUID
+	DeletionReason sql.NullString
+}
+
+func (q *Queries) ReclassifyChirpDeletion(ctx context.Context, arg ReclassifyChirpDeletionParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, reclassifyChirpDeletion, arg.ID, arg.DeletedBy, arg.DeletionReason)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL,
+deleted_by = NULL,
+deletion_reason = NULL,
+updated_at = NOW()
+WHERE id = $1
+AND deleted_at IS NOT NULL
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :one
+UPDATE chirps
+SET deleted_at = NOW(),
+deleted_by = $2,
+deletion_reason = $3,
+updated_at = NOW()
+WHERE id = $1
+AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position
+`
+
+type SoftDeleteChirpParams struct {
+	ID             uuid.UUID
+	DeletedBy      uuid.NullUUID
+	DeletionReason sql.NullString
+}
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, arg SoftDeleteChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, softDeleteChirp, arg.ID, arg.DeletedBy, arg.DeletionReason)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
+}
+
+const startThread = `-- name: StartThread :one
+
+UPDATE chirps
+SET thread_id = id,
+thread_position = 1
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, deleted_by, deletion_reason, hidden_at, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position
+`
+
+// StartThread makes a chirp the first of a thread.
+func (q *Queries) StartThread(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, startThread, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.DeletionReason,
+		&i.HiddenAt,
+		&i.Visibility,
+		&i.PublishAt,
+		&i.PublishedAt,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.ThreadPosition,
+	)
+	return i, err
+}
+
+const unhideChirp = `-- name: UnhideChirp :exec
+UPDATE chirps
+SET hidden_at = NULL
+WHERE id = $1
+`
+
+func (q *Queries) UnhideChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, unhideChirp, id)
+	return err
+}
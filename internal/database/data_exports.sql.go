@@ -0,0 +1,190 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: data_exports.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const completeDataExport = `-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready',
+file_path = $2,
+expires_at = $3,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type CompleteDataExportParams struct {
+	ID        uuid.UUID
+	FilePath  sql.NullString
+	ExpiresAt sql.NullTime
+}
+
+func (q *Queries) CompleteDataExport(ctx context.Context, arg CompleteDataExportParams) error {
+	_, err := q.db.ExecContext(ctx, completeDataExport, arg.ID, arg.FilePath, arg.ExpiresAt)
+	return err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'pending'
+)
+RETURNING id, created_at, updated_at, user_id, status, file_path, error, expires_at
+`
+
+func (q *Queries) CreateDataExport(ctx context.Context, userID uuid.UUID) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, createDataExport, userID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.Error,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const expireDataExport = `-- name: ExpireDataExport :exec
+UPDATE data_exports
+SET status = 'expired',
+file_path = NULL,
+updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ExpireDataExport(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, expireDataExport, id)
+	return err
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed',
+error = $2,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type FailDataExportParams struct {
+	ID    uuid.UUID
+	Error sql.NullString
+}
+
+func (q *Queries) FailDataExport(ctx context.Context, arg FailDataExportParams) error {
+	_, err := q.db.ExecContext(ctx, failDataExport, arg.ID, arg.Error)
+	return err
+}
+
+const getDataExport = `-- name: GetDataExport :one
+SELECT id, created_at, updated_at, user_id, status, file_path, error, expires_at FROM data_exports
+WHERE data_exports.id = $1
+AND data_exports.user_id = $2
+`
+
+type GetDataExportParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetDataExport(ctx context.Context, arg GetDataExportParams) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, getDataExport, arg.ID, arg.UserID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.FilePath,
+		&i.Error,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const listExpiredDataExports = `-- name: ListExpiredDataExports :many
+SELECT id, created_at, updated_at, user_id, status, file_path, error, expires_at FROM data_exports
+WHERE status = 'ready'
+AND expires_at <= NOW()
+ORDER BY expires_at
+LIMIT $1
+`
+
+func (q *Queries) ListExpiredDataExports(ctx context.Context, limit int32) ([]DataExport, error) {
+	rows, err := q.db.QueryContext(ctx, listExpiredDataExports, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataExport
+	for rows.Next() {
+		var i DataExport
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Status,
+			&i.FilePath,
+			&i.Error,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPurgeableDataExportFiles = `-- name: ListPurgeableDataExportFiles :many
+SELECT data_exports.file_path::text FROM data_exports
+JOIN users ON users.id = data_exports.user_id
+WHERE users.delete_after IS NOT NULL
+AND users.delete_after <= NOW()
+AND data_exports.file_path IS NOT NULL
+`
+
+func (q *Queries) ListPurgeableDataExportFiles(ctx context.Context) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPurgeableDataExportFiles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var data_exports_file_path string
+		if err := rows.Scan(&data_exports_file_path); err != nil {
+			return nil, err
+		}
+		items = append(items, data_exports_file_path)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,161 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: drafts.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createDraft = `-- name: CreateDraft :one
+INSERT INTO chirp_drafts (id, created_at, updated_at, user_id, body, visibility)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, updated_at, user_id, body, visibility
+`
+
+type CreateDraftParams struct {
+	UserID     uuid.UUID
+	Body       string
+	Visibility string
+}
+
+func (q *Queries) CreateDraft(ctx context.Context, arg CreateDraftParams) (ChirpDraft, error) {
+	row := q.db.QueryRowContext(ctx, createDraft, arg.UserID, arg.Body, arg.Visibility)
+	var i ChirpDraft
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const deleteDraft = `-- name: DeleteDraft :execrows
+DELETE FROM chirp_drafts
+WHERE id = $1
+AND user_id = $2
+`
+
+type DeleteDraftParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteDraft(ctx context.Context, arg DeleteDraftParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDraft, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getDraft = `-- name: GetDraft :one
+SELECT id, created_at, updated_at, user_id, body, visibility FROM chirp_drafts
+WHERE id = $1
+AND user_id = $2
+`
+
+type GetDraftParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetDraft(ctx context.Context, arg GetDraftParams) (ChirpDraft, error) {
+	row := q.db.QueryRowContext(ctx, getDraft, arg.ID, arg.UserID)
+	var i ChirpDraft
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const listDrafts = `-- name: ListDrafts :many
+SELECT id, created_at, updated_at, user_id, body, visibility FROM chirp_drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC
+`
+
+func (q *Queries) ListDrafts(ctx context.Context, userID uuid.UUID) ([]ChirpDraft, error) {
+	rows, err := q.db.QueryContext(ctx, listDrafts, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpDraft
+	for rows.Next() {
+		var i ChirpDraft
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Body,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateDraft = `-- name: UpdateDraft :one
+UPDATE chirp_drafts
+SET body = $3,
+visibility = $4,
+updated_at = NOW()
+WHERE id = $1
+AND user_id = $2
+RETURNING id, created_at, updated_at, user_id, body, visibility
+`
+
+type UpdateDraftParams struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Body       string
+	Visibility string
+}
+
+func (q *Queries) UpdateDraft(ctx context.Context, arg UpdateDraftParams) (ChirpDraft, error) {
+	row := q.db.QueryRowContext(ctx, updateDraft,
+		arg.ID,
+		arg.UserID,
+		arg.Body,
+		arg.Visibility,
+	)
+	var i ChirpDraft
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.Visibility,
+	)
+	return i, err
+}
@@ -0,0 +1,287 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: jobs.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimJobs = `-- name: ClaimJobs :many
+
+UPDATE jobs
+SET status = 'running',
+attempts = jobs.attempts + 1,
+locked_until = $1::timestamp,
+updated_at = NOW()
+WHERE jobs.id IN (
+    SELECT due.id FROM jobs due
+    WHERE (due.status = 'queued' AND due.run_at <= NOW())
+    OR (due.status = 'running' AND due.locked_until < NOW())
+    ORDER BY due.run_at ASC
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, kind, payload, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, finished_at
+`
+
+type ClaimJobsParams struct {
+	LeaseUntil time.Time
+	Batch      int32
+}
+
+// ClaimJobs picks due jobs, and running jobs whose lease ran out because
+// their runner died, and leases them to the caller until lease_until.
+func (q *Queries) ClaimJobs(ctx context.Context, arg ClaimJobsParams) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, claimJobs, arg.LeaseUntil, arg.Batch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Job
+	for rows.Next() {
+		var i Job
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Kind,
+			&i.Payload,
+			&i.UniqueKey,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.RunAt,
+			&i.LockedUntil,
+			&i.LastError,
+			&i.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const completeJob = `-- name: CompleteJob :exec
+UPDATE jobs
+SET status = 'succeeded',
+locked_until = NULL,
+finished_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) CompleteJob(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, completeJob, id)
+	return err
+}
+
+const enqueueJob = `-- name: EnqueueJob :execrows
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, unique_key, max_attempts, run_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING
+`
+
+type EnqueueJobParams struct {
+	Kind        string
+	Payload     json.RawMessage
+	UniqueKey   sql.NullString
+	MaxAttempts int32
+	RunAt       time.Time
+}
+
+func (q *Queries) EnqueueJob(ctx context.Context, arg EnqueueJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enqueueJob,
+		arg.Kind,
+		arg.Payload,
+		arg.UniqueKey,
+		arg.MaxAttempts,
+		arg.RunAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const failJob = `-- name: FailJob :exec
+
+UPDATE jobs
+SET status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'queued' END,
+run_at = $1,
+locked_until = NULL,
+last_error = $2::text,
+finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END,
+updated_at = NOW()
+WHERE id = $3
+`
+
+type FailJobParams struct {
+	NextRunAt time.Time
+	Error     string
+	ID        uuid.UUID
+}
+
+// FailJob queues a failed job again at next_run_at, unless it used its last
+// attempt.
+func (q *Queries) FailJob(ctx context.Context, arg FailJobParams) error {
+	_, err := q.db.ExecContext(ctx, failJob, arg.NextRunAt, arg.Error, arg.ID)
+	return err
+}
+
+const getJob = `-- name: GetJob :one
+SELECT id, created_at, updated_at, kind, payload, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, finished_at FROM jobs
+WHERE id = $1
+`
+
+func (q *Queries) GetJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	row := q.db.QueryRowContext(ctx, getJob, id)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.UniqueKey,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.LastError,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
+const listJobs = `-- name: ListJobs :many
+SELECT id, created_at, updated_at, kind, payload, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, finished_at FROM jobs
+WHERE ($1::text IS NULL OR status = $1)
+AND ($2::text IS NULL OR kind = $2)
+ORDER BY created_at DESC
+LIMIT $4
+OFFSET $3
+`
+
+type ListJobsParams struct {
+	Status sql.NullString
+	Kind   sql.NullString
+	Offset int32
+	Limit  int32
+}
+
+func (q *Queries) ListJobs(ctx context.Context, arg ListJobsParams) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, listJobs,
+		arg.Status,
+		arg.Kind,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Job
+	for rows.Next() {
+		var i Job
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Kind,
+			&i.Payload,
+			&i.UniqueKey,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.RunAt,
+			&i.LockedUntil,
+			&i.LastError,
+			&i.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const pruneJobs = `-- name: PruneJobs :execrows
+DELETE FROM jobs
+WHERE status IN ('succeeded', 'failed')
+AND finished_at < $1
+`
+
+func (q *Queries) PruneJobs(ctx context.Context, finishedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneJobs, finishedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const retryJob = `-- name: RetryJob :one
+
+UPDATE jobs
+SET status = 'queued',
+attempts = 0,
+run_at = NOW(),
+finished_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+AND status = 'failed'
+RETURNING id, created_at, updated_at, kind, payload, unique_key, status, attempts, max_attempts, run_at, locked_until, last_error, finished_at
+`
+
+// RetryJob queues a failed job again right away, with a fresh set of
+// attempts.
+func (q *Queries) RetryJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	row := q.db.QueryRowContext(ctx, retryJob, id)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.UniqueKey,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.LastError,
+		&i.FinishedAt,
+	)
+	return i, err
+}
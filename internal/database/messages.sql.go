@@ -0,0 +1,409 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: messages.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const addConversationParticipant = `-- name: AddConversationParticipant :exec
+INSERT INTO conversation_participants (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW())
+`
+
+type AddConversationParticipantParams struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+}
+
+func (q *Queries) AddConversationParticipant(ctx context.Context, arg AddConversationParticipantParams) error {
+	_, err := q.db.ExecContext(ctx, addConversationParticipant, arg.ConversationID, arg.UserID)
+	return err
+}
+
+const createConversation = `-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, created_by)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1
+)
+RETURNING id, created_at, updated_at, created_by
+`
+
+func (q *Queries) CreateConversation(ctx context.Context, createdBy uuid.NullUUID) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, createConversation, createdBy)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CreatedBy,
+	)
+	return i, err
+}
+
+const createMessage = `-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING id, created_at, conversation_id, sender_id, body
+`
+
+type CreateMessageParams struct {
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
+	row := q.db.QueryRowContext(ctx, createMessage, arg.ConversationID, arg.SenderID, arg.Body)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.ConversationID,
+		&i.SenderID,
+		&i.Body,
+	)
+	return i, err
+}
+
+const findDirectConversation = `-- name: FindDirectConversation :one
+
+SELECT conversations.id, conversations.created_at, conversations.updated_at, conversations.created_by FROM conversations
+WHERE EXISTS (
+    SELECT 1 FROM conversation_participants
+    WHERE conversation_participants.conversation_id = conversations.id
+    AND conversation_participants.user_id = $1
+)
+AND EXISTS (
+    SELECT 1 FROM conversation_participants
+    WHERE conversation_participants.conversation_id = conversations.id
+    AND conversation_participants.user_id = $2
+)
+AND (
+    SELECT COUNT(*) FROM conversation_participants
+    WHERE conversation_participants.conversation_id = conversations.id
+) = 2
+ORDER BY created_at ASC
+LIMIT 1
+`
+
+type FindDirectConversationParams struct {
+	UserA uuid.UUID
+	UserB uuid.UUID
+}
+
+// A one-to-one conversation is reused when it is started again.
+func (q *Queries) FindDirectConversation(ctx context.Context, arg FindDirectConversationParams) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, findDirectConversation, arg.UserA, arg.UserB)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CreatedBy,
+	)
+	return i, err
+}
+
+const getConversationForParticipant = `-- name: GetConversationForParticipant :one
+SELECT conversations.id, conversations.created_at, conversations.updated_at, conversations.created_by FROM conversations
+JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id
+WHERE conversations.id = $1
+AND conversation_participants.user_id = $2
+`
+
+type GetConversationForParticipantParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetConversationForParticipant(ctx context.Context, arg GetConversationForParticipantParams) (Conversation, error) {
+	row := q.db.QueryRowContext(ctx, getConversationForParticipant, arg.ID, arg.UserID)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CreatedBy,
+	)
+	return i, err
+}
+
+const getSentMessages = `-- name: GetSentMessages :many
+SELECT id, created_at, conversation_id, sender_id, body FROM messages
+WHERE sender_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetSentMessages(ctx context.Context, senderID uuid.UUID) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, getSentMessages, senderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Body,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationParticipants = `-- name: ListConversationParticipants :many
+SELECT conversation_id, user_id, joined_at, last_read_at FROM conversation_participants
+WHERE conversation_id = $1
+ORDER BY joined_at ASC
+`
+
+func (q *Queries) ListConversationParticipants(ctx context.Context, conversationID uuid.UUID) ([]ConversationParticipant, error) {
+	rows, err := q.db.QueryContext(ctx, listConversationParticipants, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ConversationParticipant
+	for rows.Next() {
+		var i ConversationParticipant
+		if err := rows.Scan(
+			&i.ConversationID,
+			&i.UserID,
+			&i.JoinedAt,
+			&i.LastReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversations = `-- name: ListConversations :many
+SELECT
+    conversations.id, conversations.created_at, conversations.updated_at, conversations.created_by,
+    (
+        SELECT COUNT(*) FROM messages
+        WHERE messages.conversation_id = conversations.id
+        AND messages.sender_id <> conversation_participants.user_id
+        AND messages.created_at > COALESCE(conversation_participants.last_read_at, '-infinity')
+    ) AS unread_count
+FROM conversations
+JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id
+WHERE conversation_participants.user_id = $1
+ORDER BY conversations.updated_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListConversationsParams struct {
+	UserID uuid.UUID
+	Limit  int32
+	Offset int32
+}
+
+type ListConversationsRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CreatedBy   uuid.NullUUID
+	UnreadCount int64
+}
+
+func (q *Queries) ListConversations(ctx context.Context, arg ListConversationsParams) ([]ListConversationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listConversations, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListConversationsRow
+	for rows.Next() {
+		var i ListConversationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CreatedBy,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessages = `-- name: ListMessages :many
+SELECT id, created_at, conversation_id, sender_id, body FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3
+`
+
+type ListMessagesParams struct {
+	ConversationID uuid.UUID
+	Limit          int32
+	Offset         int32
+}
+
+func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessages, arg.ConversationID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Message
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Body,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listParticipantsOfConversations = `-- name: ListParticipantsOfConversations :many
+SELECT conversation_id, user_id, joined_at, last_read_at FROM conversation_participants
+WHERE conversation_id = ANY($1::uuid[])
+ORDER BY joined_at ASC
+`
+
+func (q *Queries) ListParticipantsOfConversations(ctx context.Context, conversationIds []uuid.UUID) ([]ConversationParticipant, error) {
+	rows, err := q.db.QueryContext(ctx, listParticipantsOfConversations, pq.Array(conversationIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ConversationParticipant
+	for rows.Next() {
+		var i ConversationParticipant
+		if err := rows.Scan(
+			&i.ConversationID,
+			&i.UserID,
+			&i.JoinedAt,
+			&i.LastReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockDirectConversation = `-- name: LockDirectConversation :exec
+
+SELECT pg_advisory_xact_lock(hashtext(
+    'direct_conversation:'
+    || LEAST($1::uuid, $2::uuid)::text
+    || ':'
+    || GREATEST($1::uuid, $2::uuid)::text
+))
+`
+
+type LockDirectConversationParams struct {
+	UserA uuid.UUID
+	UserB uuid.UUID
+}
+
+// LockDirectConversation holds, until the transaction ends, a lock on the
+// pair of users, so only one one-to-one conversation is started between
+// them.
+func (q *Queries) LockDirectConversation(ctx context.Context, arg LockDirectConversationParams) error {
+	_, err := q.db.ExecContext(ctx, lockDirectConversation, arg.UserA, arg.UserB)
+	return err
+}
+
+const markConversationRead = `-- name: MarkConversationRead :one
+UPDATE conversation_participants
+SET last_read_at = NOW()
+WHERE conversation_id = $1
+AND user_id = $2
+RETURNING conversation_id, user_id, joined_at, last_read_at
+`
+
+type MarkConversationReadParams struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+}
+
+func (q *Queries) MarkConversationRead(ctx context.Context, arg MarkConversationReadParams) (ConversationParticipant, error) {
+	row := q.db.QueryRowContext(ctx, markConversationRead, arg.ConversationID, arg.UserID)
+	var i ConversationParticipant
+	err := row.Scan(
+		&i.ConversationID,
+		&i.UserID,
+		&i.JoinedAt,
+		&i.LastReadAt,
+	)
+	return i, err
+}
+
+const touchConversation = `-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, touchConversation, id)
+	return err
+}
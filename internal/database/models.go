@@ -6,17 +6,157 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   uuid.NullUUID
+	Details    json.RawMessage
+	Ip         string
+	UserAgent  string
+	RequestID  string
+}
+
 type Chirp struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Body           string
+	UserID         uuid.UUID
+	DeletedAt      sql.NullTime
+	DeletedBy      uuid.NullUUID
+	DeletionReason sql.NullString
+	HiddenAt       sql.NullTime
+	Visibility     string
+	PublishAt      sql.NullTime
+	PublishedAt    sql.NullTime
+	ReplyToID      uuid.NullUUID
+	ThreadID       uuid.NullUUID
+	ThreadPosition sql.NullInt32
+}
+
+type ChirpDraft struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Body       string
+	Visibility string
+}
+
+type ChirpEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	ChirpID   uuid.UUID
+	Type      string
+	Position  sql.NullInt64
+}
+
+type Conversation struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	CreatedBy uuid.NullUUID
+}
+
+type ConversationParticipant struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DataExport struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Body      string
 	UserID    uuid.UUID
+	Status    string
+	FilePath  sql.NullString
+	Error     sql.NullString
+	ExpiresAt sql.NullTime
+}
+
+type Job struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	UniqueKey   sql.NullString
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+	LockedUntil sql.NullTime
+	LastError   sql.NullString
+	FinishedAt  sql.NullTime
+}
+
+type Message struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+}
+
+type Notification struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Kind       string
+	TargetType string
+	TargetID   uuid.UUID
+	ActorIds   []uuid.UUID
+	EventCount int32
+	ReadAt     sql.NullTime
+	GroupID    uuid.UUID
+}
+
+type Poll struct {
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+	ClosesAt  time.Time
+	ClosedAt  sql.NullTime
+}
+
+type PollOption struct {
+	ChirpID  uuid.UUID
+	Position int32
+	Label    string
+	Votes    sql.NullInt32
+}
+
+type PollVote struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	Position  int32
+	CreatedAt time.Time
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
+}
+
+type ReaderAccess struct {
+	OwnerID   uuid.UUID
+	ReaderID  uuid.UUID
+	Status    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,6 +168,24 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Report struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ReporterID uuid.UUID
+	TargetType string
+	ChirpID    uuid.NullUUID
+	UserID     uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ClaimedBy  uuid.NullUUID
+	ClaimedAt  sql.NullTime
+	ResolvedBy uuid.NullUUID
+	ResolvedAt sql.NullTime
+	Resolution sql.NullString
+}
+
 type User struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
@@ -35,4 +193,49 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	DeleteAfter    sql.NullTime
+	Role           string
+	Status         string
+	SuspendedUntil sql.NullTime
+	IsProtected    bool
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Webhook struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Url        string
+	EventTypes []string
+	Secret     string
+	Active     bool
+	CreatedBy  uuid.NullUUID
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	LastStatusCode sql.NullInt32
+	LastError      sql.NullString
+	DeliveredAt    sql.NullTime
 }
@@ -0,0 +1,176 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: notifications.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const addNotification = `-- name: AddNotification :exec
+INSERT INTO notifications (id, created_at, updated_at, user_id, kind, target_type, target_id, group_id, actor_ids)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    CASE WHEN $6::uuid IS NULL THEN '{}'::uuid[]
+    ELSE ARRAY[$6::uuid] END
+)
+ON CONFLICT (user_id, kind, group_id) WHERE read_at IS NULL DO UPDATE
+SET updated_at = NOW(),
+target_id = EXCLUDED.target_id,
+event_count = notifications.event_count + 1,
+actor_ids = CASE WHEN $6::uuid IS NULL THEN notifications.actor_ids
+    ELSE array_prepend($6::uuid, array_remove(notifications.actor_ids, $6::uuid)) END
+`
+
+type AddNotificationParams struct {
+	UserID     uuid.UUID
+	Kind       string
+	TargetType string
+	TargetID   uuid.UUID
+	GroupID    uuid.UUID
+	ActorID    uuid.NullUUID
+}
+
+func (q *Queries) AddNotification(ctx context.Context, arg AddNotificationParams) error {
+	_, err := q.db.ExecContext(ctx, addNotification,
+		arg.UserID,
+		arg.Kind,
+		arg.TargetType,
+		arg.TargetID,
+		arg.GroupID,
+		arg.ActorID,
+	)
+	return err
+}
+
+const countUnreadNotifications = `-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1
+AND read_at IS NULL
+`
+
+func (q *Queries) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUnreadNotifications, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const listNotifications = `-- name: ListNotifications :many
+SELECT notifications.id, notifications.created_at, notifications.updated_at, notifications.user_id, notifications.kind, notifications.target_type, notifications.target_id, notifications.actor_ids, notifications.event_count, notifications.read_at, notifications.group_id, users.email AS latest_actor_email
+FROM notifications
+LEFT JOIN users ON users.id = notifications.actor_ids[1]
+WHERE notifications.user_id = $1
+AND (NOT $2::boolean OR notifications.read_at IS NULL)
+ORDER BY notifications.updated_at DESC
+LIMIT $4 OFFSET $3
+`
+
+type ListNotificationsParams struct {
+	UserID     uuid.UUID
+	UnreadOnly bool
+	Offset     int32
+	Limit      int32
+}
+
+type ListNotificationsRow struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           uuid.UUID
+	Kind             string
+	TargetType       string
+	TargetID         uuid.UUID
+	ActorIds         []uuid.UUID
+	EventCount       int32
+	ReadAt           sql.NullTime
+	GroupID          uuid.UUID
+	LatestActorEmail sql.NullString
+}
+
+func (q *Queries) ListNotifications(ctx context.Context, arg ListNotificationsParams) ([]ListNotificationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listNotifications,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListNotificationsRow
+	for rows.Next() {
+		var i ListNotificationsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Kind,
+			&i.TargetType,
+			&i.TargetID,
+			pq.Array(&i.ActorIds),
+			&i.EventCount,
+			&i.ReadAt,
+			&i.GroupID,
+			&i.LatestActorEmail,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAllNotificationsRead = `-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1
+AND read_at IS NULL
+`
+
+func (q *Queries) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markAllNotificationsRead, userID)
+	return err
+}
+
+const markNotificationRead = `-- name: MarkNotificationRead :execrows
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1
+AND user_id = $2
+`
+
+type MarkNotificationReadParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) MarkNotificationRead(ctx context.Context, arg MarkNotificationReadParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markNotificationRead, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,241 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: polls.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const addPollOption = `-- name: AddPollOption :exec
+INSERT INTO poll_options (chirp_id, position, label)
+VALUES ($1, $2, $3)
+`
+
+type AddPollOptionParams struct {
+	ChirpID  uuid.UUID
+	Position int32
+	Label    string
+}
+
+func (q *Queries) AddPollOption(ctx context.Context, arg AddPollOptionParams) error {
+	_, err := q.db.ExecContext(ctx, addPollOption, arg.ChirpID, arg.Position, arg.Label)
+	return err
+}
+
+const castVote = `-- name: CastVote :execrows
+
+INSERT INTO poll_votes (chirp_id, user_id, position, created_at)
+SELECT polls.chirp_id, $1, $2, NOW()
+FROM polls
+WHERE polls.chirp_id = $3
+AND polls.closed_at IS NULL
+AND polls.closes_at > NOW()
+ON CONFLICT (chirp_id, user_id) DO NOTHING
+`
+
+type CastVoteParams struct {
+	UserID   uuid.UUID
+	Position int32
+	ChirpID  uuid.UUID
+}
+
+// CastVote records a vote while the poll is open. Nothing is recorded if
+// the user already voted.
+func (q *Queries) CastVote(ctx context.Context, arg CastVoteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, castVote, arg.UserID, arg.Position, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const closePolls = `-- name: ClosePolls :many
+
+UPDATE polls
+SET closed_at = NOW()
+WHERE polls.chirp_id IN (
+    SELECT due.chirp_id FROM polls due
+    WHERE due.closed_at IS NULL
+    AND due.closes_at <= NOW()
+    ORDER BY due.closes_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING polls.chirp_id
+`
+
+// ClosePolls marks a batch of the polls past their closing time closed.
+func (q *Queries) ClosePolls(ctx context.Context, limit int32) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, closePolls, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var chirp_id uuid.UUID
+		if err := rows.Scan(&chirp_id); err != nil {
+			return nil, err
+		}
+		items = append(items, chirp_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createPoll = `-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, created_at, closes_at)
+VALUES ($1, NOW(), $2)
+`
+
+type CreatePollParams struct {
+	ChirpID  uuid.UUID
+	ClosesAt time.Time
+}
+
+func (q *Queries) CreatePoll(ctx context.Context, arg CreatePollParams) error {
+	_, err := q.db.ExecContext(ctx, createPoll, arg.ChirpID, arg.ClosesAt)
+	return err
+}
+
+const getPoll = `-- name: GetPoll :one
+SELECT chirp_id, created_at, closes_at, closed_at FROM polls
+WHERE chirp_id = $1
+`
+
+func (q *Queries) GetPoll(ctx context.Context, chirpID uuid.UUID) (Poll, error) {
+	row := q.db.QueryRowContext(ctx, getPoll, chirpID)
+	var i Poll
+	err := row.Scan(
+		&i.ChirpID,
+		&i.CreatedAt,
+		&i.ClosesAt,
+		&i.ClosedAt,
+	)
+	return i, err
+}
+
+const listPollOptions = `-- name: ListPollOptions :many
+
+SELECT polls.chirp_id, polls.closes_at, polls.closed_at,
+    poll_options.position, poll_options.label,
+    COALESCE(poll_options.votes, tally.votes, 0)::bigint AS votes,
+    mine.position AS voted_position
+FROM polls
+JOIN poll_options ON poll_options.chirp_id = polls.chirp_id
+LEFT JOIN (
+    SELECT poll_votes.chirp_id, poll_votes.position, COUNT(*) AS votes
+    FROM poll_votes
+    WHERE poll_votes.chirp_id = ANY($1::uuid[])
+    GROUP BY poll_votes.chirp_id, poll_votes.position
+) tally ON tally.chirp_id = poll_options.chirp_id
+    AND tally.position = poll_options.position
+LEFT JOIN poll_votes mine ON mine.chirp_id = polls.chirp_id
+    AND mine.user_id = $2::uuid
+WHERE polls.chirp_id = ANY($1::uuid[])
+ORDER BY polls.chirp_id, poll_options.position
+`
+
+type ListPollOptionsParams struct {
+	ChirpIds []uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+type ListPollOptionsRow struct {
+	ChirpID       uuid.UUID
+	ClosesAt      time.Time
+	ClosedAt      sql.NullTime
+	Position      int32
+	Label         string
+	Votes         int64
+	VotedPosition sql.NullInt32
+}
+
+// ListPollOptions returns the options of the polls of the given chirps, with
+// their tallies and the option the viewer voted for, if any.
+func (q *Queries) ListPollOptions(ctx context.Context, arg ListPollOptionsParams) ([]ListPollOptionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPollOptions, pq.Array(arg.ChirpIds), arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPollOptionsRow
+	for rows.Next() {
+		var i ListPollOptionsRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.ClosesAt,
+			&i.ClosedAt,
+			&i.Position,
+			&i.Label,
+			&i.Votes,
+			&i.VotedPosition,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPollVoters = `-- name: ListPollVoters :many
+SELECT user_id FROM poll_votes
+WHERE chirp_id = $1
+`
+
+func (q *Queries) ListPollVoters(ctx context.Context, chirpID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listPollVoters, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordPollTallies = `-- name: RecordPollTallies :exec
+UPDATE poll_options
+SET votes = (
+    SELECT COUNT(*) FROM poll_votes tally
+    WHERE tally.chirp_id = poll_options.chirp_id
+    AND tally.position = poll_options.position
+)
+WHERE poll_options.chirp_id = ANY($1::uuid[])
+`
+
+func (q *Queries) RecordPollTallies(ctx context.Context, chirpIds []uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, recordPollTallies, pq.Array(chirpIds))
+	return err
+}
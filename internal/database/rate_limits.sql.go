@@ -0,0 +1,62 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: rate_limits.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const pruneRateLimitBuckets = `-- name: PruneRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1
+`
+
+func (q *Queries) PruneRateLimitBuckets(ctx context.Context, updatedAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneRateLimitBuckets, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (
+    $1,
+    $2::float8 - 1,
+    true,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET
+    tokens = CASE
+        WHEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8) >= 1
+        THEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8) - 1
+        ELSE LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8)
+    END,
+    allowed = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key      string
+	Capacity float64
+	Rate     float64
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64
+	Allowed bool
+}
+
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Capacity, arg.Rate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
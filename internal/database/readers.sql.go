@@ -0,0 +1,158 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: readers.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const approveReader = `-- name: ApproveReader :one
+UPDATE reader_access
+SET status = 'approved',
+updated_at = NOW()
+WHERE owner_id = $1
+AND reader_id = $2
+RETURNING owner_id, reader_id, status, created_at, updated_at
+`
+
+type ApproveReaderParams struct {
+	OwnerID  uuid.UUID
+	ReaderID uuid.UUID
+}
+
+func (q *Queries) ApproveReader(ctx context.Context, arg ApproveReaderParams) (ReaderAccess, error) {
+	row := q.db.QueryRowContext(ctx, approveReader, arg.OwnerID, arg.ReaderID)
+	var i ReaderAccess
+	err := row.Scan(
+		&i.OwnerID,
+		&i.ReaderID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listReaders = `-- name: ListReaders :many
+SELECT owner_id, reader_id, status, created_at, updated_at FROM reader_access
+WHERE owner_id = $1
+AND ($2::text IS NULL OR status = $2::text)
+ORDER BY created_at DESC
+`
+
+type ListReadersParams struct {
+	OwnerID uuid.UUID
+	Status  sql.NullString
+}
+
+func (q *Queries) ListReaders(ctx context.Context, arg ListReadersParams) ([]ReaderAccess, error) {
+	rows, err := q.db.QueryContext(ctx, listReaders, arg.OwnerID, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ReaderAccess
+	for rows.Next() {
+		var i ReaderAccess
+		if err := rows.Scan(
+			&i.OwnerID,
+			&i.ReaderID,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeReader = `-- name: RemoveReader :execrows
+DELETE FROM reader_access
+WHERE owner_id = $1
+AND reader_id = $2
+`
+
+type RemoveReaderParams struct {
+	OwnerID  uuid.UUID
+	ReaderID uuid.UUID
+}
+
+func (q *Queries) RemoveReader(ctx context.Context, arg RemoveReaderParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, removeReader, arg.OwnerID, arg.ReaderID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requestReaderAccess = `-- name: RequestReaderAccess :one
+INSERT INTO reader_access (owner_id, reader_id, status, created_at, updated_at)
+VALUES ($1, $2, 'pending', NOW(), NOW())
+ON CONFLICT (owner_id, reader_id) DO UPDATE
+SET updated_at = reader_access.updated_at
+RETURNING owner_id, reader_id, status, created_at, updated_at
+`
+
+type RequestReaderAccessParams struct {
+	OwnerID  uuid.UUID
+	ReaderID uuid.UUID
+}
+
+func (q *Queries) RequestReaderAccess(ctx context.Context, arg RequestReaderAccessParams) (ReaderAccess, error) {
+	row := q.db.QueryRowContext(ctx, requestReaderAccess, arg.OwnerID, arg.ReaderID)
+	var i ReaderAccess
+	err := row.Scan(
+		&i.OwnerID,
+		&i.ReaderID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const setUserProtected = `-- name: SetUserProtected :one
+UPDATE users
+SET is_protected = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected
+`
+
+type SetUserProtectedParams struct {
+	ID          uuid.UUID
+	IsProtected bool
+}
+
+func (q *Queries) SetUserProtected(ctx context.Context, arg SetUserProtectedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserProtected, arg.ID, arg.IsProtected)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
+	)
+	return i, err
+}
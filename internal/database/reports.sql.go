@@ -0,0 +1,289 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: reports.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const claimReport = `-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed',
+claimed_by = $2,
+claimed_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2))
+RETURNING id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details, status, claimed_by, claimed_at, resolved_by, resolved_at, resolution
+`
+
+type ClaimReportParams struct {
+	ID        uuid.UUID
+	ClaimedBy uuid.NullUUID
+}
+
+func (q *Queries) ClaimReport(ctx context.Context, arg ClaimReportParams) (Report, error) {
+	row := q.db.QueryRowContext(ctx, claimReport, arg.ID, arg.ClaimedBy)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ReporterID,
+		&i.TargetType,
+		&i.ChirpID,
+		&i.UserID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ClaimedBy,
+		&i.ClaimedAt,
+		&i.ResolvedBy,
+		&i.ResolvedAt,
+		&i.Resolution,
+	)
+	return i, err
+}
+
+const countPendingChirpReporters = `-- name: CountPendingChirpReporters :one
+SELECT COUNT(DISTINCT reporter_id) FROM reports
+WHERE chirp_id = $1
+AND status <> 'resolved'
+`
+
+func (q *Queries) CountPendingChirpReporters(ctx context.Context, chirpID uuid.NullUUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPendingChirpReporters, chirpID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createReport = `-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details, status, claimed_by, claimed_at, resolved_by, resolved_at, resolution
+`
+
+type CreateReportParams struct {
+	ReporterID uuid.UUID
+	TargetType string
+	ChirpID    uuid.NullUUID
+	UserID     uuid.UUID
+	Reason     string
+	Details    string
+}
+
+func (q *Queries) CreateReport(ctx context.Context, arg CreateReportParams) (Report, error) {
+	row := q.db.QueryRowContext(ctx, createReport,
+		arg.ReporterID,
+		arg.TargetType,
+		arg.ChirpID,
+		arg.UserID,
+		arg.Reason,
+		arg.Details,
+	)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ReporterID,
+		&i.TargetType,
+		&i.ChirpID,
+		&i.UserID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ClaimedBy,
+		&i.ClaimedAt,
+		&i.ResolvedBy,
+		&i.ResolvedAt,
+		&i.Resolution,
+	)
+	return i, err
+}
+
+const getReport = `-- name: GetReport :one
+SELECT id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details, status, claimed_by, claimed_at, resolved_by, resolved_at, resolution FROM reports
+WHERE reports.id = $1
+`
+
+func (q *Queries) GetReport(ctx context.Context, id uuid.UUID) (Report, error) {
+	row := q.db.QueryRowContext(ctx, getReport, id)
+	var i Report
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ReporterID,
+		&i.TargetType,
+		&i.ChirpID,
+		&i.UserID,
+		&i.Reason,
+		&i.Details,
+		&i.Status,
+		&i.ClaimedBy,
+		&i.ClaimedAt,
+		&i.ResolvedBy,
+		&i.ResolvedAt,
+		&i.Resolution,
+	)
+	return i, err
+}
+
+const listReports = `-- name: ListReports :many
+SELECT id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details, status, claimed_by, claimed_at, resolved_by, resolved_at, resolution FROM reports
+WHERE ($1::text IS NULL OR status = $1::text)
+AND ($1::text IS NOT NULL OR $2::boolean OR status <> 'resolved')
+AND ($3::text IS NULL OR target_type = $3::text)
+AND ($4::text IS NULL OR reason = $4::text)
+ORDER BY created_at ASC
+LIMIT $6
+OFFSET $5
+`
+
+type ListReportsParams struct {
+	Status          sql.NullString
+	IncludeResolved bool
+	TargetType      sql.NullString
+	Reason          sql.NullString
+	Offset          int32
+	Limit           int32
+}
+
+func (q *Queries) ListReports(ctx context.Context, arg ListReportsParams) ([]Report, error) {
+	rows, err := q.db.QueryContext(ctx, listReports,
+		arg.Status,
+		arg.IncludeResolved,
+		arg.TargetType,
+		arg.Reason,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Report
+	for rows.Next() {
+		var i Report
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ReporterID,
+			&i.TargetType,
+			&i.ChirpID,
+			&i.UserID,
+			&i.Reason,
+			&i.Details,
+			&i.Status,
+			&i.ClaimedBy,
+			&i.ClaimedAt,
+			&i.ResolvedBy,
+			&i.ResolvedAt,
+			&i.Resolution,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resolveReportsForTarget = `-- name: ResolveReportsForTarget :many
+
+UPDATE reports
+SET status = 'resolved',
+resolved_by = $1,
+resolved_at = NOW(),
+resolution = $2,
+updated_at = NOW()
+WHERE status <> 'resolved'
+AND target_type = $3
+AND user_id = $4
+AND chirp_id IS NOT DISTINCT FROM $5
+AND (id <> $6 OR claimed_by IS NULL OR claimed_by = $1)
+RETURNING id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details, status, claimed_by, claimed_at, resolved_by, resolved_at, resolution
+`
+
+type ResolveReportsForTargetParams struct {
+	ResolvedBy uuid.NullUUID
+	Resolution sql.NullString
+	TargetType string
+	UserID     uuid.UUID
+	ChirpID    uuid.NullUUID
+	ReportID   uuid.UUID
+}
+
+// ResolveReportsForTarget resolves the pending reports on the target of
+// report_id, leaving that report out when another admin claimed it. Reports
+// resolved concurrently are waited for and skipped, so report_id is only
+// returned by the admin who got there first.
+func (q *Queries) ResolveReportsForTarget(ctx context.Context, arg ResolveReportsForTargetParams) ([]Report, error) {
+	rows, err := q.db.QueryContext(ctx, resolveReportsForTarget,
+		arg.ResolvedBy,
+		arg.Resolution,
+		arg.TargetType,
+		arg.UserID,
+		arg.ChirpID,
+		arg.ReportID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Report
+	for rows.Next() {
+		var i Report
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.ReporterID,
+			&i.TargetType,
+			&i.ChirpID,
+			&i.UserID,
+			&i.Reason,
+			&i.Details,
+			&i.Status,
+			&i.ClaimedBy,
+			&i.ClaimedAt,
+			&i.ResolvedBy,
+			&i.ResolvedAt,
+			&i.Resolution,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -7,11 +7,25 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users
+SET delete_after = NULL,
+updated_at = NOW()
+WHERE users.id = $1
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -21,7 +35,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected
 `
 
 type CreateUserParams struct {
@@ -39,17 +53,35 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
 	)
 	return i, err
 }
 
-const deleteUser = `-- name: DeleteUser :one
+const deleteNonAdminUsers = `-- name: DeleteNonAdminUsers :execrows
 DELETE FROM users
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+WHERE role <> 'admin'
 `
 
-func (q *Queries) DeleteUser(ctx context.Context) (User, error) {
-	row := q.db.QueryRowContext(ctx, deleteUser)
+func (q *Queries) DeleteNonAdminUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteNonAdminUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected FROM users
+WHERE users.id = $1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -58,12 +90,17 @@ func (q *Queries) DeleteUser(ctx context.Context) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected FROM users
 WHERE users.email = $1
 `
 
@@ -77,6 +114,263 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected FROM users
+WHERE users.id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
+	)
+	return i, err
+}
+
+const listMentionedUsers = `-- name: ListMentionedUsers :many
+SELECT users.id FROM users
+WHERE lower(split_part(users.email, '@', 1)) = ANY($1::text[])
+AND users.id <> $2
+AND chirp_visible_to($2, $3, users.id)
+`
+
+type ListMentionedUsersParams struct {
+	Names      []string
+	AuthorID   uuid.UUID
+	Visibility string
+}
+
+func (q *Queries) ListMentionedUsers(ctx context.Context, arg ListMentionedUsersParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listMentionedUsers, pq.Array(arg.Names), arg.AuthorID, arg.Visibility)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected FROM users
+WHERE ($1::text IS NULL OR strpos(lower(email), lower($1::text)) > 0)
+AND ($2::text IS NULL OR status = $2::text)
+AND ($3::text IS NULL OR role = $3::text)
+ORDER BY created_at DESC
+LIMIT $5
+OFFSET $4
+`
+
+type ListUsersParams struct {
+	Query  sql.NullString
+	Status sql.NullString
+	Role   sql.NullString
+	Offset int32
+	Limit  int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers,
+		arg.Query,
+		arg.Status,
+		arg.Role,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.DeleteAfter,
+			&i.Role,
+			&i.Status,
+			&i.SuspendedUntil,
+			&i.IsProtected,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE delete_after IS NOT NULL
+AND delete_after <= NOW()
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET delete_after = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING delete_after
+`
+
+type ScheduleUserDeletionParams struct {
+	ID          uuid.UUID
+	DeleteAfter sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeleteAfter)
+	var delete_after sql.NullTime
+	err := row.Scan(&delete_after)
+	return delete_after, err
+}
+
+const setUserChirpyRed = `-- name: SetUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected
+`
+
+type SetUserChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserChirpyRed, arg.ID, arg.IsChirpyRed)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
+	)
+	return i, err
+}
+
+const setUserStatus = `-- name: SetUserStatus :one
+UPDATE users
+SET status = $2,
+suspended_until = $3,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, delete_after, role, status, suspended_until, is_protected
+`
+
+type SetUserStatusParams struct {
+	ID             uuid.UUID
+	Status         string
+	SuspendedUntil sql.NullTime
+}
+
+func (q *Queries) SetUserStatus(ctx context.Context, arg SetUserStatusParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserStatus, arg.ID, arg.Status, arg.SuspendedUntil)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.DeleteAfter,
+		&i.Role,
+		&i.Status,
+		&i.SuspendedUntil,
+		&i.IsProtected,
 	)
 	return i, err
 }
@@ -87,7 +381,7 @@ SET email = $2,
 hashed_password = $3,
 updated_at = NOW()
 WHERE users.id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red
+RETURNING id, created_at, updated_at, email, is_chirpy_red, is_protected
 `
 
 type UpdateUserCredentialsParams struct {
@@ -102,6 +396,7 @@ type UpdateUserCredentialsRow struct {
 	UpdatedAt   time.Time
 	Email       string
 	IsChirpyRed bool
+	IsProtected bool
 }
 
 func (q *Queries) UpdateUserCredentials(ctx context.Context, arg UpdateUserCredentialsParams) (UpdateUserCredentialsRow, error) {
@@ -113,17 +408,21 @@ func (q *Queries) UpdateUserCredentials(ctx context.Context, arg UpdateUserCrede
 		&i.UpdatedAt,
 		&i.Email,
 		&i.IsChirpyRed,
+		&i.IsProtected,
 	)
 	return i, err
 }
 
-const upgradeUser = `-- name: UpgradeUser :exec
+const upgradeUser = `-- name: UpgradeUser :execrows
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
 `
 
-func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradeUser, id)
-	return err
+func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, upgradeUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
@@ -0,0 +1,430 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: webhooks.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+
+UPDATE webhook_deliveries
+SET next_attempt_at = $1,
+updated_at = NOW()
+FROM webhooks
+WHERE webhooks.id = webhook_deliveries.webhook_id
+AND webhook_deliveries.id IN (
+    SELECT pending.id FROM webhook_deliveries pending
+    WHERE pending.status = 'pending'
+    AND pending.next_attempt_at <= NOW()
+    ORDER BY pending.next_attempt_at ASC
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING webhook_deliveries.id, webhook_deliveries.created_at, webhook_deliveries.updated_at, webhook_deliveries.webhook_id, webhook_deliveries.event_id, webhook_deliveries.event_type, webhook_deliveries.payload, webhook_deliveries.status, webhook_deliveries.attempts, webhook_deliveries.next_attempt_at, webhook_deliveries.last_attempt_at, webhook_deliveries.last_status_code, webhook_deliveries.last_error, webhook_deliveries.delivered_at, webhooks.url, webhooks.secret
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseUntil time.Time
+	Batch      int32
+}
+
+type ClaimWebhookDeliveriesRow struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	WebhookID      uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	LastStatusCode sql.NullInt32
+	LastError      sql.NullString
+	DeliveredAt    sql.NullTime
+	Url            string
+	Secret         string
+}
+
+// ClaimWebhookDeliveries picks due deliveries and pushes their next attempt
+// back to the end of a lease, so another replica only retries them if this
+// one dies before recording the attempt.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]ClaimWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveries, arg.LeaseUntil, arg.Batch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.WebhookID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+			&i.Url,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, url, event_types, secret, created_by)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING id, created_at, updated_at, url, event_types, secret, active, created_by
+`
+
+type CreateWebhookParams struct {
+	Url        string
+	EventTypes []string
+	Secret     string
+	CreatedBy  uuid.NullUUID
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, createWebhook,
+		arg.Url,
+		pq.Array(arg.EventTypes),
+		arg.Secret,
+		arg.CreatedBy,
+	)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedBy,
+	)
+	return i, err
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1
+`
+
+func (q *Queries) DeleteWebhook(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhook, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enqueueWebhookDeliveries = `-- name: EnqueueWebhookDeliveries :exec
+
+INSERT INTO webhook_deliveries (id, created_at, updated_at, webhook_id, event_id, event_type, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), webhooks.id, $1, $2, $3, NOW()
+FROM webhooks
+WHERE webhooks.active
+AND ($4::uuid IS NULL OR webhooks.id = $4::uuid)
+AND ($4::uuid IS NOT NULL OR $2::text = ANY(webhooks.event_types))
+`
+
+type EnqueueWebhookDeliveriesParams struct {
+	EventID   uuid.UUID
+	EventType string
+	Payload   json.RawMessage
+	WebhookID uuid.NullUUID
+}
+
+// EnqueueWebhookDeliveries adds a delivery of an event to every active
+// webhook subscribed to its type, or only to the given webhook if set.
+func (q *Queries) EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) error {
+	_, err := q.db.ExecContext(ctx, enqueueWebhookDeliveries,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+		arg.WebhookID,
+	)
+	return err
+}
+
+const getWebhook = `-- name: GetWebhook :one
+SELECT id, created_at, updated_at, url, event_types, secret, active, created_by FROM webhooks
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhook(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, getWebhook, id)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedBy,
+	)
+	return i, err
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, created_at, updated_at, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, delivered_at FROM webhook_deliveries
+WHERE webhook_id = $1
+AND ($2::text IS NULL OR status = $2::text)
+ORDER BY created_at DESC
+LIMIT $4 OFFSET $3
+`
+
+type ListWebhookDeliveriesParams struct {
+	WebhookID uuid.UUID
+	Status    sql.NullString
+	Offset    int32
+	Limit     int32
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries,
+		arg.WebhookID,
+		arg.Status,
+		arg.Offset,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.WebhookID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooks = `-- name: ListWebhooks :many
+SELECT id, created_at, updated_at, url, event_types, secret, active, created_by FROM webhooks
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Webhook
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Url,
+			pq.Array(&i.EventTypes),
+			&i.Secret,
+			&i.Active,
+			&i.CreatedBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookDelivered = `-- name: RecordWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered',
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+last_status_code = $2,
+last_error = NULL,
+delivered_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+`
+
+type RecordWebhookDeliveredParams struct {
+	ID             uuid.UUID
+	LastStatusCode sql.NullInt32
+}
+
+func (q *Queries) RecordWebhookDelivered(ctx context.Context, arg RecordWebhookDeliveredParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookDelivered, arg.ID, arg.LastStatusCode)
+	return err
+}
+
+const recordWebhookFailure = `-- name: RecordWebhookFailure :exec
+UPDATE webhook_deliveries
+SET status = CASE WHEN attempts + 1 >= $1::int THEN 'dead' ELSE 'pending' END,
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+last_status_code = $2,
+last_error = $3::text,
+next_attempt_at = $4,
+updated_at = NOW()
+WHERE id = $5
+`
+
+type RecordWebhookFailureParams struct {
+	MaxAttempts   int32
+	StatusCode    sql.NullInt32
+	Error         string
+	NextAttemptAt time.Time
+	ID            uuid.UUID
+}
+
+func (q *Queries) RecordWebhookFailure(ctx context.Context, arg RecordWebhookFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordWebhookFailure,
+		arg.MaxAttempts,
+		arg.StatusCode,
+		arg.Error,
+		arg.NextAttemptAt,
+		arg.ID,
+	)
+	return err
+}
+
+const redeliverWebhookDelivery = `-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending',
+attempts = 0,
+next_attempt_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND webhook_id = $2
+RETURNING id, created_at, updated_at, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, delivered_at
+`
+
+type RedeliverWebhookDeliveryParams struct {
+	ID        uuid.UUID
+	WebhookID uuid.UUID
+}
+
+func (q *Queries) RedeliverWebhookDelivery(ctx context.Context, arg RedeliverWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, redeliverWebhookDelivery, arg.ID, arg.WebhookID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WebhookID,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+	)
+	return i, err
+}
+
+const updateWebhook = `-- name: UpdateWebhook :one
+UPDATE webhooks
+SET url = $2,
+event_types = $3,
+active = $4,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, url, event_types, secret, active, created_by
+`
+
+type UpdateWebhookParams struct {
+	ID         uuid.UUID
+	Url        string
+	EventTypes []string
+	Active     bool
+}
+
+func (q *Queries) UpdateWebhook(ctx context.Context, arg UpdateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, updateWebhook,
+		arg.ID,
+		arg.Url,
+		pq.Array(arg.EventTypes),
+		arg.Active,
+	)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.Active,
+		&i.CreatedBy,
+	)
+	return i, err
+}
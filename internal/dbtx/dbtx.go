@@ -0,0 +1,39 @@
+package dbtx
+
+import (
+	"context"
+	"strings"
+)
+
+// Hook is called before every query with its text. The returned context is
+// used to run the query and done is called with its outcome.
+type Hook func(ctx context.Context, query string) (queryCtx context.Context, done func(err error))
+
+// chain runs hooks in order around a query, the first one outermost.
+func chain(hooks []Hook) Hook {
+	return func(ctx context.Context, query string) (context.Context, func(error)) {
+		dones := make([]func(error), len(hooks))
+		for i, hook := range hooks {
+			ctx, dones[i] = hook(ctx, query)
+		}
+		return ctx, func(err error) {
+			for i := len(dones) - 1; i >= 0; i-- {
+				dones[i](err)
+			}
+		}
+	}
+}
+
+// QueryName extracts the method name from the "-- name: X :kind" header sqlc
+// puts at the top of every generated query.
+func QueryName(query string) string {
+	header, _, _ := strings.Cut(query, "\n")
+	if !strings.HasPrefix(header, "-- name:") {
+		return "unknown"
+	}
+	fields := strings.Fields(strings.TrimPrefix(header, "-- name:"))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return fields[0]
+}
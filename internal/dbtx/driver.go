@@ -0,0 +1,130 @@
+package dbtx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Connector wraps c so hooks run around every query made on its
+// connections, whether through the pool or a transaction. Queries returning
+// rows are only reported done once their rows are closed, with the error that
+// stopped their iteration.
+func Connector(c driver.Connector, hooks ...Hook) driver.Connector {
+	return &connector{Connector: c, hook: chain(hooks)}
+}
+
+type connector struct {
+	driver.Connector
+	hook Hook
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	driverConn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: driverConn, hook: c.hook}, nil
+}
+
+// conn forwards every optional interface the driver connection has, running
+// hook around queries.
+type conn struct {
+	driver.Conn
+	hook Hook
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := c.hook(ctx, query)
+	result, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+	return &rows{Rows: result, done: done}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, done := c.hook(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	done(err)
+	return result, err
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	ctx, done := c.hook(ctx, query)
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	done(err)
+	return stmt, err
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	if opts.ReadOnly || opts.Isolation != 0 {
+		return nil, errors.New("dbtx: driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// rows calls done once closed, with the error Next failed with if any.
+type rows struct {
+	driver.Rows
+	done func(err error)
+	err  error
+	once sync.Once
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.err = err
+	}
+	return err
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		r.done(errors.Join(r.err, err))
+	})
+	return err
+}
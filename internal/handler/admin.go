@@ -0,0 +1,504 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// AdminUser is a user as admins see it.
+type AdminUser struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Email          string     `json:"email"`
+	ChirpyRed      bool       `json:"is_chirpy_red"`
+	Protected      bool       `json:"is_protected"`
+	Role           string     `json:"role"`
+	Status         string     `json:"status"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	DeleteAfter    *time.Time `json:"delete_after"`
+}
+
+func adminUser(user database.User) AdminUser {
+	return AdminUser{
+		ID:             user.ID,
+		CreatedAt:      user.CreatedAt,
+		UpdatedAt:      user.UpdatedAt,
+		Email:          user.Email,
+		ChirpyRed:      user.IsChirpyRed,
+		Protected:      user.IsProtected,
+		Role:           user.Role,
+		Status:         accountStatus(user),
+		SuspendedUntil: nullTimePtr(user.SuspendedUntil),
+		DeleteAfter:    nullTimePtr(user.DeleteAfter),
+	}
+}
+
+const maxAdminPageSize = 100
+
+// AdminListUsers lists users, newest first. The q, status and role query
+// parameters filter them by email substring, account status and role.
+func (cfg *APIConfig) AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimit(r, maxAdminPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	query := r.URL.Query()
+	dbUsers, err := cfg.DB.ListUsers(r.Context(), database.ListUsersParams{
+		Query:  nullString(query.Get("q")),
+		Status: nullString(query.Get("status")),
+		Role:   nullString(query.Get("role")),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing users", err)
+		return
+	}
+	users := []AdminUser{}
+	for _, user := range dbUsers {
+		users = append(users, adminUser(user))
+	}
+	JsonResponse(w, http.StatusOK, users)
+}
+
+func (cfg *APIConfig) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	user, err := cfg.DB.GetUser(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		handleError(w, r, "Error getting user", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, adminUser(user))
+}
+
+// AdminSuspendUser suspends a user until the given time, or until reinstated
+// when none is given, and signs them out.
+func (cfg *APIConfig) AdminSuspendUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Until  *time.Time `json:"until"`
+		Reason string     `json:"reason"`
+	}
+	params := parameters{}
+	err := decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	until := sql.NullTime{}
+	if params.Until != nil {
+		if !params.Until.After(time.Now()) {
+			respondValidationError(w, r, []FieldError{{Field: "until", Message: "Must be in the future"}})
+			return
+		}
+		until = sql.NullTime{Time: params.Until.UTC(), Valid: true}
+	}
+	details := map[string]any{"reason": params.Reason}
+	if until.Valid {
+		details["until"] = until.Time
+	}
+	cfg.setUserStatus(w, r, statusSuspended, until, audit.ActionUserSuspend, details)
+}
+
+// AdminBanUser bans a user for good and signs them out.
+func (cfg *APIConfig) AdminBanUser(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+	params := parameters{}
+	err := decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	cfg.setUserStatus(w, r, statusBanned, sql.NullTime{}, audit.ActionUserBan, map[string]any{"reason": params.Reason})
+}
+
+// AdminReinstateUser lifts a suspension or ban.
+func (cfg *APIConfig) AdminReinstateUser(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserStatus(w, r, statusActive, sql.NullTime{}, audit.ActionUserReinstate, nil)
+}
+
+// errAdminTarget is returned when suspending or banning an admin, who has to
+// lose the admin role first.
+var errAdminTarget = errors.New("admins can't be suspended or banned")
+
+// restrictUser suspends or bans a user and signs them out. Admins are
+// refused with errAdminTarget.
+func restrictUser(ctx context.Context, q *database.Queries, params database.SetUserStatusParams) (database.User, error) {
+	user, err := q.GetUserForUpdate(ctx, params.ID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if user.Role == roleAdmin {
+		return database.User{}, errAdminTarget
+	}
+	user, err = q.SetUserStatus(ctx, params)
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, q.RevokeUserRefreshTokens(ctx, params.ID)
+}
+
+// respondAdminTarget refuses to suspend or ban an admin.
+func respondAdminTarget(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusConflict, CodeConflict, "Admins can't be suspended or banned, revoke their admin role first")
+}
+
+func (cfg *APIConfig) setUserStatus(w http.ResponseWriter, r *http.Request, status string, until sql.NullTime, action string, details map[string]any) {
+	logger := logging.FromContext(r.Context())
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	if id == admin.ID {
+		respondError(w, r, http.StatusConflict, CodeConflict, "You cannot change the status of your own account")
+		return
+	}
+
+	var user database.User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		params := database.SetUserStatusParams{
+			ID:             id,
+			Status:         status,
+			SuspendedUntil: until,
+		}
+		if status == statusActive {
+			user, err = q.SetUserStatus(r.Context(), params)
+		} else {
+			user, err = restrictUser(r.Context(), q, params)
+		}
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     action,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.NullID(id),
+			Details:    details,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		if errors.Is(err, errAdminTarget) {
+			respondAdminTarget(w, r)
+			return
+		}
+		handleError(w, r, "Error updating user status", err)
+		return
+	}
+	logger.Info("Changed user status", "target_user_id", id, "status", status)
+	JsonResponse(w, http.StatusOK, adminUser(user))
+}
+
+// AdminGrantRed gives a user Chirpy Red, AdminRevokeRed takes it away.
+func (cfg *APIConfig) AdminGrantRed(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserChirpyRed(w, r, true)
+}
+
+func (cfg *APIConfig) AdminRevokeRed(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserChirpyRed(w, r, false)
+}
+
+func (cfg *APIConfig) setUserChirpyRed(w http.ResponseWriter, r *http.Request, red bool) {
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	action := audit.ActionUserGrantRed
+	if !red {
+		action = audit.ActionUserRevokeRed
+	}
+
+	var user database.User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		user, err = q.SetUserChirpyRed(r.Context(), database.SetUserChirpyRedParams{
+			ID:          id,
+			IsChirpyRed: red,
+		})
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     action,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.NullID(id),
+		})
+		if err != nil || !red {
+			return err
+		}
+		return webhook.Enqueue(r.Context(), q, webhook.EventUserUpgraded, map[string]any{"user_id": id, "source": "admin"})
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		handleError(w, r, "Error updating Chirpy Red", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, adminUser(user))
+}
+
+// AdminSetRole makes a user an admin or takes the role away.
+func (cfg *APIConfig) AdminSetRole(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	if params.Role != roleAdmin && params.Role != roleUser {
+		respondValidationError(w, r, []FieldError{{Field: "role", Message: "Must be admin or user"}})
+		return
+	}
+	if id == admin.ID {
+		respondError(w, r, http.StatusConflict, CodeConflict, "You cannot change your own role")
+		return
+	}
+
+	var user database.User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		user, err = q.SetUserRole(r.Context(), database.SetUserRoleParams{
+			ID:   id,
+			Role: params.Role,
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionUserSetRole,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.NullID(id),
+			Details:    map[string]any{"role": params.Role},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		handleError(w, r, "Error updating user role", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, adminUser(user))
+}
+
+// AdminRemoveChirp takes down any user's chirp. The reason query parameter
+// is moderator, the default, or legal; an optional note is kept in the audit
+// log. The chirp is kept, hidden, until purged.
+func (cfg *APIConfig) AdminRemoveChirp(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("chirpID"), "chirpID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = deletionByModerator
+	}
+	if reason != deletionByModerator && reason != deletionForLegal {
+		handleError(w, r, "Invalid reason", &paramError{Field: "reason", Message: "Must be moderator or legal", Err: fmt.Errorf("unknown reason %q", reason)})
+		return
+	}
+
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		chirp, err := takeDownChirp(r.Context(), q, id, admin.ID, reason)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionChirpRemove,
+			TargetType: audit.TargetChirp,
+			TargetID:   audit.NullID(id),
+			Details: map[string]any{
+				"author_id": chirp.UserID,
+				"reason":    reason,
+				"note":      r.URL.Query().Get("note"),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if chirp.ownerDeleted {
+			return nil
+		}
+		return chirpWebhook(r.Context(), q, webhook.EventChirpDeleted, chirp.Chirp)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp not found")
+			return
+		}
+		handleError(w, r, "Error removing chirp", err)
+		return
+	}
+	logger.Info("Removed chirp", "chirp_id", id, "reason", reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// takedown is a chirp taken down by a moderator. ownerDeleted is set
+// when its owner had deleted it already: the deletion was only taken over,
+// so they can no longer restore it, and it was announced back then.
+type takedown struct {
+	database.Chirp
+	ownerDeleted bool
+}
+
+// takeDownChirp deletes a chirp on behalf of a moderator, or takes over its
+// deletion when its owner deleted it. Chirps a moderator removed already
+// answer sql.ErrNoRows.
+func takeDownChirp(ctx context.Context, q *database.Queries, id, by uuid.UUID, reason string) (takedown, error) {
+	chirp, err := q.SoftDeleteChirp(ctx, database.SoftDeleteChirpParams{
+		ID:             id,
+		DeletedBy:      audit.NullID(by),
+		DeletionReason: sql.NullString{String: reason, Valid: true},
+	})
+	if err == nil {
+		return takedown{Chirp: chirp}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return takedown{}, err
+	}
+	chirp, err = q.ReclassifyChirpDeletion(ctx, database.ReclassifyChirpDeletionParams{
+		ID:             id,
+		DeletedBy:      audit.NullID(by),
+		DeletionReason: sql.NullString{String: reason, Valid: true},
+	})
+	if err != nil {
+		return takedown{}, err
+	}
+	return takedown{Chirp: chirp, ownerDeleted: true}, nil
+}
+
+// AdminRestoreChirp undeletes a chirp, whoever deleted it and whenever.
+func (cfg *APIConfig) AdminRestoreChirp(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("chirpID"), "chirpID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+
+	var chirp database.Chirp
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		chirp, err = q.RestoreChirp(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionChirpRestore,
+			TargetType: audit.TargetChirp,
+			TargetID:   audit.NullID(id),
+		})
+		if err != nil {
+			return err
+		}
+		return chirpWebhook(r.Context(), q, webhook.EventChirpRestored, chirp)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Deleted chirp not found")
+			return
+		}
+		handleError(w, r, "Error restoring chirp", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, removedChirp(chirp))
+}
+
+// RemovedChirp is a deleted chirp as admins see it.
+type RemovedChirp struct {
+	Chirp
+	DeletedAt      *time.Time `json:"deleted_at"`
+	DeletedBy      *uuid.UUID `json:"deleted_by"`
+	DeletionReason string     `json:"deletion_reason,omitempty"`
+}
+
+func removedChirp(chirp database.Chirp) RemovedChirp {
+	return RemovedChirp{
+		Chirp:          chirpResponse(chirp),
+		DeletedAt:      nullTimePtr(chirp.DeletedAt),
+		DeletedBy:      nullUUIDPtr(chirp.DeletedBy),
+		DeletionReason: chirp.DeletionReason.String,
+	}
+}
+
+// AdminListRemovedChirps lists deleted chirps not purged yet, most recently
+// deleted first, filtered by the reason and author_id query parameters.
+func (cfg *APIConfig) AdminListRemovedChirps(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimit(r, maxAdminPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	params := database.ListDeletedChirpsParams{
+		Reason: nullString(r.URL.Query().Get("reason")),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if value := r.URL.Query().Get("author_id"); value != "" {
+		authorId, err := parseUUID(value, "author_id")
+		if err != nil {
+			handleError(w, r, "Incorrect author ID", err)
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorId, Valid: true}
+	}
+	dbChirps, err := cfg.DB.ListDeletedChirps(r.Context(), params)
+	if err != nil {
+		handleError(w, r, "Error listing removed chirps", err)
+		return
+	}
+	chirps := []RemovedChirp{}
+	for _, chirp := range dbChirps {
+		chirps = append(chirps, removedChirp(chirp))
+	}
+	JsonResponse(w, http.StatusOK, chirps)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+// recordAudit records event, made through r, with q. Pass the queries of the
+// transaction making the change.
+func recordAudit(r *http.Request, q *database.Queries, event audit.Event) error {
+	return audit.Record(r.Context(), q, audit.WithRequest(r, event))
+}
+
+// recordEvent records event on its own, for actions that already happened
+// or changed nothing. A failure is logged rather than failing the request.
+func (cfg *APIConfig) recordEvent(r *http.Request, event audit.Event) {
+	err := recordAudit(r, cfg.DB, event)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error recording audit event", "action", event.Action, "error", err)
+	}
+}
+
+// AuditEvent is an audit log entry as admins see it.
+type AuditEvent struct {
+	ID         uuid.UUID       `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorID    *uuid.UUID      `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   *uuid.UUID      `json:"target_id"`
+	Details    json.RawMessage `json:"details"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+}
+
+// AdminListAuditEvents pages through the audit log, newest first. It can be
+// filtered with the actor_id, target_id, action and target_type query
+// parameters, and since and until RFC 3339 times.
+func (cfg *APIConfig) AdminListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimit(r, maxAdminPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	query := r.URL.Query()
+	params := database.ListAuditEventsParams{
+		Action:     nullString(query.Get("action")),
+		TargetType: nullString(query.Get("target_type")),
+		Limit:      limit,
+		Offset:     offset,
+	}
+	for field, dest := range map[string]*uuid.NullUUID{"actor_id": &params.ActorID, "target_id": &params.TargetID} {
+		if value := query.Get(field); value != "" {
+			id, err := parseUUID(value, field)
+			if err != nil {
+				handleError(w, r, "Invalid filter", err)
+				return
+			}
+			*dest = uuid.NullUUID{UUID: id, Valid: true}
+		}
+	}
+	for field, dest := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		if value := query.Get(field); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				handleError(w, r, "Invalid filter", &paramError{Field: field, Message: "Must be an RFC 3339 time", Err: err})
+				return
+			}
+			*dest = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
+	dbEvents, err := cfg.DB.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		handleError(w, r, "Error listing audit events", err)
+		return
+	}
+	events := []AuditEvent{}
+	for _, event := range dbEvents {
+		events = append(events, AuditEvent{
+			ID:         event.ID,
+			CreatedAt:  event.CreatedAt,
+			ActorID:    nullUUIDPtr(event.ActorID),
+			Action:     event.Action,
+			TargetType: event.TargetType,
+			TargetID:   nullUUIDPtr(event.TargetID),
+			Details:    event.Details,
+			IP:         event.Ip,
+			UserAgent:  event.UserAgent,
+			RequestID:  event.RequestID,
+		})
+	}
+	JsonResponse(w, http.StatusOK, events)
+}
+
+// PruneAuditEvents deletes audit events older than the retention period.
+func (cfg *APIConfig) PruneAuditEvents(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	count, err := cfg.DB.PruneAuditEvents(ctx, time.Now().Add(-cfg.AuditRetention))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Info("Pruned audit events", "count", count)
+	}
+	return nil
+}
+
+func nullUUIDPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
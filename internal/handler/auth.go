@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/auth"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+// authError reports a request without a valid access token.
+type authError struct {
+	Err error
+}
+
+func (e *authError) Error() string {
+	return fmt.Sprintf("unauthenticated: %v", e.Err)
+}
+
+func (e *authError) Unwrap() error {
+	return e.Err
+}
+
+// accountError reports a user whose account was suspended or banned.
+type accountError struct {
+	Status string
+}
+
+func (e *accountError) Error() string {
+	return fmt.Sprintf("account is %s", e.Status)
+}
+
+// Account statuses, set by admins.
+const (
+	statusActive    = "active"
+	statusSuspended = "suspended"
+	statusBanned    = "banned"
+)
+
+// User roles.
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// accountStatus returns the status of user's account, accounting for
+// suspensions that have run out.
+func accountStatus(user database.User) string {
+	if user.Status == statusSuspended && user.SuspendedUntil.Valid && !user.SuspendedUntil.Time.After(time.Now()) {
+		return statusActive
+	}
+	return user.Status
+}
+
+// authenticateUser returns the user the request's bearer JWT was issued to,
+// provided their account is active and not pending deletion. Tokens issued
+// before the deletion was requested stop working; logging in again cancels
+// it and issues new ones.
+func (cfg *APIConfig) authenticateUser(r *http.Request) (database.User, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return database.User{}, &authError{Err: err}
+	}
+	userId, err := auth.ValidateJWT(token, cfg.JWT)
+	if err != nil {
+		return database.User{}, &authError{Err: err}
+	}
+	logging.SetUserID(r.Context(), userId)
+	user, err := cfg.DB.GetUser(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, &authError{Err: errors.New("user no longer exists")}
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	if status := accountStatus(user); status != statusActive {
+		return database.User{}, &accountError{Status: status}
+	}
+	if user.DeleteAfter.Valid {
+		return database.User{}, &accountError{Status: "pending deletion"}
+	}
+	return user, nil
+}
+
+// authenticate returns the ID of the user authenticateUser finds.
+func (cfg *APIConfig) authenticate(r *http.Request) (uuid.UUID, error) {
+	user, err := cfg.authenticateUser(r)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return user.ID, nil
+}
+
+// viewer returns the signed in user making r, for endpoints that anonymous
+// users can call too. A request with an Authorization header must carry a
+// valid token.
+func (cfg *APIConfig) viewer(r *http.Request) (uuid.NullUUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, nil
+	}
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	return uuid.NullUUID{UUID: userId, Valid: true}, nil
+}
+
+type adminKey struct{}
+
+// RequireAdmin only lets requests from admins through to next. The admin is
+// available to next through adminFromContext.
+func (cfg *APIConfig) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := cfg.authenticateUser(r)
+		if err != nil {
+			handleError(w, r, "Unauthenticated admin request", err)
+			return
+		}
+		if user.Role != roleAdmin {
+			logging.FromContext(r.Context()).Warn("Admin endpoint refused to non-admin user")
+			respondError(w, r, http.StatusForbidden, CodeForbidden, "Admin role required")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminKey{}, user)))
+	})
+}
+
+func adminFromContext(ctx context.Context) database.User {
+	user, _ := ctx.Value(adminKey{}).(database.User)
+	return user
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// blockedBetween reports whether either user blocked the other. Every path
+// where one user reaches another, such as viewing, replying to or mentioning
+// them, must go through it so blocks are enforced the same way everywhere.
+// Callers in a transaction pass its queries, so it sees the transaction's
+// rows without taking another connection.
+func blockedBetween(ctx context.Context, q *database.Queries, a, b uuid.UUID) (bool, error) {
+	if a == b {
+		return false, nil
+	}
+	return q.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{
+		UserA: a,
+		UserB: b,
+	})
+}
+
+// blockedAmong reports whether any of users blocked another of them.
+func blockedAmong(ctx context.Context, q *database.Queries, users []uuid.UUID) (bool, error) {
+	for i, a := range users {
+		for _, b := range users[i+1:] {
+			blocked, err := blockedBetween(ctx, q, a, b)
+			if err != nil || blocked {
+				return blocked, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// BlockedUser is an entry of a user's block or mute list.
+type BlockedUser struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// relationTarget authenticates r and returns its user and the user named by
+// the userID path value, who must exist and be someone else.
+func (cfg *APIConfig) relationTarget(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return uuid.UUID{}, uuid.UUID{}, false
+	}
+	targetId, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return uuid.UUID{}, uuid.UUID{}, false
+	}
+	if targetId == userId {
+		respondError(w, r, http.StatusBadRequest, CodeBadRequest, "You cannot block or mute yourself")
+		return uuid.UUID{}, uuid.UUID{}, false
+	}
+	_, err = cfg.DB.GetUser(r.Context(), targetId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return uuid.UUID{}, uuid.UUID{}, false
+		}
+		handleError(w, r, "Error getting user", err)
+		return uuid.UUID{}, uuid.UUID{}, false
+	}
+	return userId, targetId, true
+}
+
+// BlockUser blocks a user: neither of them sees the other's chirps or can
+// interact with the other any more.
+func (cfg *APIConfig) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userId, targetId, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.DB.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userId,
+		BlockedID: targetId,
+	})
+	if err != nil {
+		handleError(w, r, "Error blocking user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userId, targetId, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.DB.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userId,
+		BlockedID: targetId,
+	})
+	if err != nil {
+		handleError(w, r, "Error unblocking user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MuteUser hides a user's chirps from the caller only, the muted user can
+// still see and interact with theirs.
+func (cfg *APIConfig) MuteUser(w http.ResponseWriter, r *http.Request) {
+	userId, targetId, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.DB.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userId,
+		MutedID: targetId,
+	})
+	if err != nil {
+		handleError(w, r, "Error muting user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) UnmuteUser(w http.ResponseWriter, r *http.Request) {
+	userId, targetId, ok := cfg.relationTarget(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.DB.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userId,
+		MutedID: targetId,
+	})
+	if err != nil {
+		handleError(w, r, "Error unmuting user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) ListBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	blocks, err := cfg.DB.ListBlockedUsers(r.Context(), userId)
+	if err != nil {
+		handleError(w, r, "Error listing blocked users", err)
+		return
+	}
+	users := []BlockedUser{}
+	for _, block := range blocks {
+		users = append(users, BlockedUser{UserID: block.BlockedID, CreatedAt: block.CreatedAt})
+	}
+	JsonResponse(w, http.StatusOK, users)
+}
+
+func (cfg *APIConfig) ListMutedUsers(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	mutes, err := cfg.DB.ListMutedUsers(r.Context(), userId)
+	if err != nil {
+		handleError(w, r, "Error listing muted users", err)
+		return
+	}
+	users := []BlockedUser{}
+	for _, mute := range mutes {
+		users = append(users, BlockedUser{UserID: mute.MutedID, CreatedAt: mute.CreatedAt})
+	}
+	JsonResponse(w, http.StatusOK, users)
+}
@@ -1,213 +1,473 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
-	"github.com/finchrelia/chirpy-server/internal/auth"
+	"github.com/finchrelia/chirpy-server/internal/audit"
 	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
 	"github.com/google/uuid"
 )
 
+// Why a chirp was deleted. Owners can only restore chirps they deleted
+// themselves.
+const (
+	deletionByOwner     = "owner"
+	deletionByModerator = "moderator"
+	deletionForLegal    = "legal"
+)
+
 type Chirp struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	UserID    uuid.UUID `json:"user_id"`
 	Body      string    `json:"body"`
+	// Visibility is public, readers (approved readers only) or private.
+	Visibility string `json:"visibility"`
+	// PublishAt is when a scheduled chirp is due, PublishedAt is unset
+	// until then.
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at"`
+	// Chirps posted as a thread reply to the previous one and have their
+	// position in it.
+	ReplyToID      *uuid.UUID `json:"reply_to_id,omitempty"`
+	ThreadID       *uuid.UUID `json:"thread_id,omitempty"`
+	ThreadPosition int32      `json:"thread_position,omitempty"`
+	// Poll is only set where the viewer is known, see attachPolls.
+	Poll *Poll `json:"poll,omitempty"`
+}
+
+func chirpResponse(chirp database.Chirp) Chirp {
+	return Chirp{
+		ID:             chirp.ID,
+		CreatedAt:      chirp.CreatedAt,
+		UpdatedAt:      chirp.UpdatedAt,
+		Body:           chirp.Body,
+		UserID:         chirp.UserID,
+		Visibility:     chirp.Visibility,
+		PublishAt:      nullTimePtr(chirp.PublishAt),
+		PublishedAt:    nullTimePtr(chirp.PublishedAt),
+		ReplyToID:      nullUUIDPtr(chirp.ReplyToID),
+		ThreadID:       nullUUIDPtr(chirp.ThreadID),
+		ThreadPosition: chirp.ThreadPosition.Int32,
+	}
 }
 
+// publishBatch is how many scheduled chirps are published per transaction.
+const publishBatch = 100
+
+// Chirp visibility levels, checked by the chirp_visible_to SQL function.
+var chirpVisibilities = []string{"public", "readers", "private"}
+
+// ChirpsCreate posts a chirp, or schedules it when publish_at is given.
+// Scheduled chirps stay out of listings until published.
 func (cfg *APIConfig) ChirpsCreate(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	type parameters struct {
-		Content string `json:"body"`
+		Content    string          `json:"body"`
+		Visibility string          `json:"visibility"`
+		PublishAt  *time.Time      `json:"publish_at"`
+		Poll       *pollParameters `json:"poll"`
 	}
-	token, err := auth.GetBearerToken(r.Header)
+	userId, err := cfg.authenticate(r)
 	if err != nil {
-		log.Printf("Error extracting token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		handleError(w, r, "Unauthenticated request", err)
 		return
 	}
-	userId, err := auth.ValidateJWT(token, cfg.JWT)
+	params := parameters{}
+	err = decodeJSON(r, &params)
 	if err != nil {
-		log.Printf("Invalid JWT: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		handleError(w, r, "Error decoding parameters", err)
 		return
 	}
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	cleanedChirp, err := cfg.cleanChirp(params.Content)
 	if err != nil {
-		log.Printf("Error decoding parameters: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		logger.Info("Invalid chirp", "error", err)
+		respondValidationError(w, r, []FieldError{{Field: "body", Message: err.Error()}})
 		return
 	}
-	cleanedChirp, err := cleanChirp(params.Content)
-	if err != nil {
-		type errorResponse struct {
-			Error error `json:"error"`
-		}
-		JsonResponse(w, http.StatusBadRequest, errorResponse{Error: err})
+	if params.Visibility == "" {
+		params.Visibility = "public"
+	}
+	fieldErrors := validatePublication(params.Visibility, params.PublishAt)
+	if params.Poll != nil {
+		fieldErrors = append(fieldErrors, validatePoll(*params.Poll, params.PublishAt)...)
 	}
-	chirp, err := cfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanedChirp,
-		UserID: userId,
+	if len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+	var chirp database.Chirp
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		chirp, err = cfg.createChirp(r.Context(), q, database.CreateChirpParams{
+			Body:       cleanedChirp,
+			UserID:     userId,
+			Visibility: params.Visibility,
+			PublishAt:  nullTime(params.PublishAt),
+		})
+		if err != nil || params.Poll == nil {
+			return err
+		}
+		return cfg.createPoll(r.Context(), q, chirp.ID, *params.Poll)
 	})
 	if err != nil {
-		log.Printf("Error creating chirp: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error creating chirp", err)
 		return
 	}
-	JsonResponse(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
+	cfg.Stats.ChirpsCreated.Inc()
+	chirps := []Chirp{chirpResponse(chirp)}
+	err = cfg.attachPolls(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		handleError(w, r, "Error getting poll", err)
+		return
+	}
+	JsonResponse(w, http.StatusCreated, chirps[0])
+}
+
+// validatePublication checks the visibility and optional publish time of a
+// chirp about to be created.
+func validatePublication(visibility string, publishAt *time.Time) []FieldError {
+	fieldErrors := []FieldError{}
+	if !contains(chirpVisibilities, visibility) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "visibility", Message: "Must be one of public, readers or private"})
+	}
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "publish_at", Message: "Must be in the future"})
+	}
+	return fieldErrors
+}
+
+// nullTime converts a client time to UTC, as TIMESTAMP columns drop the
+// offset it was given with.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// createChirp stores a cleaned chirp and, unless it is scheduled, publishes
+// it.
+func (cfg *APIConfig) createChirp(ctx context.Context, q *database.Queries, params database.CreateChirpParams) (database.Chirp, error) {
+	chirp, err := q.CreateChirp(ctx, params)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if !chirp.PublishedAt.Valid {
+		return chirp, nil
+	}
+	return chirp, cfg.announceChirp(ctx, q, chirp)
+}
+
+// announceChirp tells the mentioned users and webhooks about a chirp that
+// was just published.
+func (cfg *APIConfig) announceChirp(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	err := cfg.notifyMentions(ctx, q, chirp)
+	if err != nil {
+		return err
+	}
+	return chirpWebhook(ctx, q, webhook.EventChirpCreated, chirp)
 }
 
-func cleanChirp(s string) (string, error) {
-	const maxChirpLength = 140
-	if len(s) > maxChirpLength {
-		return "", errors.New("Chirp is too long")
+// cleanChirp rejects empty or overlong chirps and censors the configured
+// banned words.
+func (cfg *APIConfig) cleanChirp(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", errors.New("Chirp is empty")
 	}
+	if len(s) > cfg.MaxChirpLength {
+		return "", fmt.Errorf("Chirp is longer than %d characters", cfg.MaxChirpLength)
+	}
+	return cfg.censor(s), nil
+}
 
+// censor masks the configured banned words in s. Everything users write for
+// others to read goes through it.
+func (cfg *APIConfig) censor(s string) string {
 	splittedString := strings.Split(s, " ")
 	for idx, element := range splittedString {
-		switch strings.ToLower(element) {
-		case
-			"kerfuffle",
-			"sharbert",
-			"fornax":
-			splittedString[idx] = "****"
+		for _, banned := range cfg.BannedWords {
+			if strings.EqualFold(element, banned) {
+				splittedString[idx] = "****"
+				break
+			}
 		}
 	}
-	return strings.Join(splittedString, " "), nil
+	return strings.Join(splittedString, " ")
 }
 
 func (cfg *APIConfig) GetChirps(w http.ResponseWriter, r *http.Request) {
+	viewerId, err := cfg.viewer(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
 	dbChirps := []database.Chirp{}
 	authorIdString := r.URL.Query().Get("author_id")
 	if authorIdString != "" {
-		authorId, err := uuid.Parse(authorIdString)
+		authorId, err := parseUUID(authorIdString, "author_id")
 		if err != nil {
-			log.Printf("Incorrect author ID: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			handleError(w, r, "Incorrect author ID", err)
 			return
 		}
-		dbChirps, err = cfg.DB.GetChirpsByUserid(r.Context(), authorId)
+		dbChirps, err = cfg.DB.GetChirpsByUserid(r.Context(), database.GetChirpsByUseridParams{
+			UserID:   authorId,
+			ViewerID: viewerId,
+		})
 		if err != nil {
-			log.Printf("No chirp for user given: %v", err)
+			handleError(w, r, "Error getting chirps by author", err)
+			return
 		}
 	} else {
-		var err error
-		dbChirps, err = cfg.DB.GetChirps(r.Context())
+		dbChirps, err = cfg.DB.GetChirps(r.Context(), viewerId)
 		if err != nil {
-			log.Printf("Error getting chirps: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			handleError(w, r, "Error getting chirps", err)
 			return
 		}
 	}
 
 	chirps := []Chirp{}
 	for _, chirp := range dbChirps {
-		chirps = append(chirps, Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID,
-		})
+		chirps = append(chirps, chirpResponse(chirp))
+	}
+	err = cfg.attachPolls(r.Context(), chirps, viewerId)
+	if err != nil {
+		handleError(w, r, "Error getting polls", err)
+		return
 	}
 	sortOrder := r.URL.Query().Get("sort")
 	sort.Slice(chirps, func(i, j int) bool {
 		if sortOrder == "desc" {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
+			return chirps[i].PublishedAt.After(*chirps[j].PublishedAt)
 		}
 		// Defaults to asc
-		return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
+		return chirps[i].PublishedAt.Before(*chirps[j].PublishedAt)
 	})
 	JsonResponse(w, http.StatusOK, chirps)
 }
 
 func (cfg *APIConfig) GetChirp(w http.ResponseWriter, r *http.Request) {
+	viewerId, err := cfg.viewer(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
 	idFromQuery := r.PathValue("chirpID")
-	id, err := uuid.Parse(idFromQuery)
+	id, err := parseUUID(idFromQuery, "chirpID")
 	if err != nil {
-		log.Printf("Not a valid ID: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Not a valid ID", err)
 		return
 	}
-	chirp, err := cfg.DB.GetChirp(r.Context(), id)
+	// Chirps the viewer may not read are reported as missing rather than
+	// forbidden so their existence isn't leaked.
+	chirp, err := cfg.DB.GetVisibleChirp(r.Context(), database.GetVisibleChirpParams{
+		ID:       id,
+		ViewerID: viewerId,
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			w.WriteHeader(http.StatusNotFound)
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp not found")
 			return
 		}
-		log.Printf("Error getting chirp: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error getting chirp", err)
 		return
 	}
-	JsonResponse(w, http.StatusOK, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
-	})
-}
-
-func (cfg *APIConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	chirps := []Chirp{chirpResponse(chirp)}
+	err = cfg.attachPolls(r.Context(), chirps, viewerId)
 	if err != nil {
-		log.Printf("Error extracting token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		handleError(w, r, "Error getting poll", err)
 		return
 	}
-	userId, err := auth.ValidateJWT(token, cfg.JWT)
+	JsonResponse(w, http.StatusOK, chirps[0])
+}
+
+func (cfg *APIConfig) DeleteChirp(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userId, err := cfg.authenticate(r)
 	if err != nil {
-		log.Printf("Invalid JWT: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		handleError(w, r, "Unauthenticated request", err)
 		return
 	}
 	idFromQuery := r.PathValue("chirpID")
 
-	id, err := uuid.Parse(idFromQuery)
+	id, err := parseUUID(idFromQuery, "chirpID")
 	if err != nil {
-		log.Printf("Not a valid ID: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Not a valid ID", err)
 		return
 	}
 	chirp, err := cfg.DB.GetChirp(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			w.WriteHeader(http.StatusNotFound)
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp not found")
 			return
 		}
-		log.Printf("Error getting chirp: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error getting chirp", err)
 		return
 	}
 	if chirp.UserID != userId {
-		log.Printf("User %s not allowed to delete chirp owned by %s", userId, chirp.UserID)
-		w.WriteHeader(http.StatusForbidden)
+		logger.Warn("User not allowed to delete chirp", "chirp_id", chirp.ID, "owner_id", chirp.UserID)
+		respondError(w, r, http.StatusForbidden, CodeForbidden, "You can only delete your own chirps")
 		return
 	}
 
-	err = cfg.DB.DeleteChirp(r.Context(), database.DeleteChirpParams{
-		ID:     id,
-		UserID: userId,
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		chirp, err := q.SoftDeleteChirp(r.Context(), database.SoftDeleteChirpParams{
+			ID:             id,
+			DeletedBy:      audit.NullID(userId),
+			DeletionReason: sql.NullString{String: deletionByOwner, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(userId),
+			Action:     audit.ActionChirpDelete,
+			TargetType: audit.TargetChirp,
+			TargetID:   audit.NullID(id),
+		})
+		if err != nil {
+			return err
+		}
+		return chirpWebhook(r.Context(), q, webhook.EventChirpDeleted, chirp)
 	})
 	if err != nil {
-		log.Printf("Error deleting chirp: %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		handleError(w, r, "Error deleting chirp", err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// RestoreChirp undeletes a chirp its owner deleted, within the undelete
+// window.
+func (cfg *APIConfig) RestoreChirp(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	id, err := parseUUID(r.PathValue("chirpID"), "chirpID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	deleted, err := cfg.DB.GetDeletedChirp(r.Context(), id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		handleError(w, r, "Error getting chirp", err)
+		return
+	}
+	if err != nil || deleted.UserID != userId {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Deleted chirp not found")
+		return
+	}
+	if deleted.DeletionReason.String != deletionByOwner {
+		respondError(w, r, http.StatusForbidden, CodeForbidden, "Chirps removed by moderators cannot be restored")
+		return
+	}
+	if time.Since(deleted.DeletedAt.Time) > cfg.UndeleteWindow {
+		respondError(w, r, http.StatusConflict, CodeConflict, "The undelete window for this chirp has passed")
+		return
+	}
+
+	var chirp database.Chirp
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		chirp, err = q.RestoreChirp(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(userId),
+			Action:     audit.ActionChirpRestore,
+			TargetType: audit.TargetChirp,
+			TargetID:   audit.NullID(id),
+		})
+		if err != nil {
+			return err
+		}
+		return chirpWebhook(r.Context(), q, webhook.EventChirpRestored, chirp)
+	})
+	if err != nil {
+		handleError(w, r, "Error restoring chirp", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, chirpResponse(chirp))
+}
+
+// PurgeDeletedChirps hard-deletes chirps deleted longer ago than the
+// retention period.
+func (cfg *APIConfig) PurgeDeletedChirps(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	count, err := cfg.DB.PurgeDeletedChirps(ctx, time.Now().Add(-cfg.DeletedChirpRetention))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Info("Purged deleted chirps", "count", count)
+	}
+	return nil
+}
+
+// ListScheduledChirps returns the caller's chirps waiting to be published,
+// soonest first. Scheduled chirps are cancelled by deleting them.
+func (cfg *APIConfig) ListScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	dbChirps, err := cfg.DB.ListScheduledChirps(r.Context(), userId)
+	if err != nil {
+		handleError(w, r, "Error listing scheduled chirps", err)
+		return
+	}
+	chirps := []Chirp{}
+	for _, chirp := range dbChirps {
+		chirps = append(chirps, chirpResponse(chirp))
+	}
+	err = cfg.attachPolls(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		handleError(w, r, "Error getting polls", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, chirps)
+}
+
+// PublishDueChirps publishes the scheduled chirps whose time has come, batch
+// after batch, telling mentioned users and webhooks like for new chirps.
+func (cfg *APIConfig) PublishDueChirps(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	for {
+		var published []database.Chirp
+		err := cfg.inTx(ctx, func(q *database.Queries) error {
+			var err error
+			published, err = q.PublishDueChirps(ctx, publishBatch)
+			if err != nil {
+				return err
+			}
+			for _, chirp := range published {
+				err = cfg.announceChirp(ctx, q, chirp)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(published) > 0 {
+			logger.Info("Published scheduled chirps", "count", len(published))
+		}
+		if len(published) < publishBatch {
+			return nil
+		}
+	}
+}
@@ -1,15 +1,40 @@
 package handler
 
 import (
-	"sync/atomic"
+	"database/sql"
+	"time"
 
 	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/metrics"
+	"github.com/finchrelia/chirpy-server/internal/stream"
 )
 
 type APIConfig struct {
-	FileserverHits atomic.Int32
-	DB             *database.Queries
-	Platform       string
-	JWT            string
-	PolkaKey       string
+	DB *database.Queries
+	// Conn lets handlers run queries in a transaction.
+	Conn  *sql.DB
+	Stats *metrics.Metrics
+	// Stream publishes chirp events to live clients.
+	Stream *stream.Hub
+
+	Platform        string
+	JWT             string
+	PolkaKey        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	MaxChirpLength int
+	BannedWords    []string
+	UndeleteWindow time.Duration
+	// DeletedChirpRetention is how long deleted chirps are kept, as evidence
+	// for reports, before being purged.
+	DeletedChirpRetention time.Duration
+	// ReportHideThreshold is how many users must report a chirp for it to be
+	// hidden pending review, 0 to never hide reported chirps.
+	ReportHideThreshold int
+
+	DeletionGracePeriod time.Duration
+	ExportDir           string
+	ExportTTL           time.Duration
+	AuditRetention      time.Duration
 }
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxDraftLength bounds what a draft can hold. Drafts may be longer than
+// chirps while being worked on, they are only checked when published.
+const maxDraftLength = 10000
+
+type Draft struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Body       string    `json:"body"`
+	Visibility string    `json:"visibility"`
+}
+
+func draftResponse(draft database.ChirpDraft) Draft {
+	return Draft{
+		ID:         draft.ID,
+		CreatedAt:  draft.CreatedAt,
+		UpdatedAt:  draft.UpdatedAt,
+		Body:       draft.Body,
+		Visibility: draft.Visibility,
+	}
+}
+
+type draftParameters struct {
+	Body       string `json:"body"`
+	Visibility string `json:"visibility"`
+}
+
+// decodeDraft reads draft parameters, defaulting to public visibility. It
+// responds and returns false when they are invalid.
+func decodeDraft(w http.ResponseWriter, r *http.Request) (draftParameters, bool) {
+	params := draftParameters{}
+	err := decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return params, false
+	}
+	if params.Visibility == "" {
+		params.Visibility = "public"
+	}
+	fieldErrors := []FieldError{}
+	if len(params.Body) > maxDraftLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "body", Message: fmt.Sprintf("Must be at most %d characters", maxDraftLength)})
+	}
+	if !contains(chirpVisibilities, params.Visibility) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "visibility", Message: "Must be one of public, readers or private"})
+	}
+	if len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return params, false
+	}
+	return params, true
+}
+
+func (cfg *APIConfig) CreateDraft(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	params, ok := decodeDraft(w, r)
+	if !ok {
+		return
+	}
+	draft, err := cfg.DB.CreateDraft(r.Context(), database.CreateDraftParams{
+		UserID:     userId,
+		Body:       params.Body,
+		Visibility: params.Visibility,
+	})
+	if err != nil {
+		handleError(w, r, "Error creating draft", err)
+		return
+	}
+	JsonResponse(w, http.StatusCreated, draftResponse(draft))
+}
+
+// ListDrafts returns the caller's drafts, most recently edited first.
+func (cfg *APIConfig) ListDrafts(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	dbDrafts, err := cfg.DB.ListDrafts(r.Context(), userId)
+	if err != nil {
+		handleError(w, r, "Error listing drafts", err)
+		return
+	}
+	drafts := []Draft{}
+	for _, draft := range dbDrafts {
+		drafts = append(drafts, draftResponse(draft))
+	}
+	JsonResponse(w, http.StatusOK, drafts)
+}
+
+// lookupDraft returns the caller's draft named by the draftID path value.
+func (cfg *APIConfig) lookupDraft(w http.ResponseWriter, r *http.Request) (database.ChirpDraft, bool) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return database.ChirpDraft{}, false
+	}
+	id, err := parseUUID(r.PathValue("draftID"), "draftID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return database.ChirpDraft{}, false
+	}
+	draft, err := cfg.DB.GetDraft(r.Context(), database.GetDraftParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Draft not found")
+			return database.ChirpDraft{}, false
+		}
+		handleError(w, r, "Error getting draft", err)
+		return database.ChirpDraft{}, false
+	}
+	return draft, true
+}
+
+func (cfg *APIConfig) GetDraft(w http.ResponseWriter, r *http.Request) {
+	draft, ok := cfg.lookupDraft(w, r)
+	if !ok {
+		return
+	}
+	JsonResponse(w, http.StatusOK, draftResponse(draft))
+}
+
+func (cfg *APIConfig) UpdateDraft(w http.ResponseWriter, r *http.Request) {
+	draft, ok := cfg.lookupDraft(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeDraft(w, r)
+	if !ok {
+		return
+	}
+	draft, err := cfg.DB.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		ID:         draft.ID,
+		UserID:     draft.UserID,
+		Body:       params.Body,
+		Visibility: params.Visibility,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Draft not found")
+			return
+		}
+		handleError(w, r, "Error updating draft", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, draftResponse(draft))
+}
+
+func (cfg *APIConfig) DeleteDraft(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	id, err := parseUUID(r.PathValue("draftID"), "draftID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	deleted, err := cfg.DB.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		handleError(w, r, "Error deleting draft", err)
+		return
+	}
+	if deleted == 0 {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Draft not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PublishDraft turns a draft into a chirp, checked and censored like any
+// other, and deletes the draft. The chirp is scheduled when publish_at is
+// given.
+func (cfg *APIConfig) PublishDraft(w http.ResponseWriter, r *http.Request) {
+	draft, ok := cfg.lookupDraft(w, r)
+	if !ok {
+		return
+	}
+	type parameters struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+	params := parameters{}
+	if r.ContentLength != 0 {
+		err := decodeJSON(r, &params)
+		if err != nil {
+			handleError(w, r, "Error decoding parameters", err)
+			return
+		}
+	}
+	fieldErrors := validatePublication(draft.Visibility, params.PublishAt)
+	cleanedChirp, err := cfg.cleanChirp(draft.Body)
+	if err != nil {
+		fieldErrors = append(fieldErrors, FieldError{Field: "body", Message: err.Error()})
+	}
+	if len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+
+	var chirp database.Chirp
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		deleted, err := q.DeleteDraft(r.Context(), database.DeleteDraftParams{
+			ID:     draft.ID,
+			UserID: draft.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			// Published or deleted in the meantime.
+			return sql.ErrNoRows
+		}
+		chirp, err = cfg.createChirp(r.Context(), q, database.CreateChirpParams{
+			Body:       cleanedChirp,
+			UserID:     draft.UserID,
+			Visibility: draft.Visibility,
+			PublishAt:  nullTime(params.PublishAt),
+		})
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Draft not found")
+			return
+		}
+		handleError(w, r, "Error publishing draft", err)
+		return
+	}
+	cfg.Stats.ChirpsCreated.Inc()
+	JsonResponse(w, http.StatusCreated, chirpResponse(chirp))
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// paramError reports a path or query parameter that could not be parsed.
+// Message tells the client what is expected, a UUID unless set.
+type paramError struct {
+	Field   string
+	Message string
+	Err     error
+}
+
+func (e *paramError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Field, e.Err)
+}
+
+func (e *paramError) Unwrap() error {
+	return e.Err
+}
+
+// bodyError reports a request body that is not the JSON document expected.
+type bodyError struct {
+	Err error
+}
+
+func (e *bodyError) Error() string {
+	return fmt.Sprintf("invalid request body: %v", e.Err)
+}
+
+func (e *bodyError) Unwrap() error {
+	return e.Err
+}
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation      = "23505"
+	pqForeignKeyViolation  = "23503"
+	pqCheckViolation       = "23514"
+	pqNotNullViolation     = "23502"
+	pqStringTooLong        = "22001"
+	pqInvalidTextParameter = "22P02"
+)
+
+// constraintFields names the request field behind a database constraint, so
+// violations can be reported against it.
+var constraintFields = map[string]string{
+	"users_email_key": "email",
+}
+
+func parseUUID(value, field string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.UUID{}, &paramError{Field: field, Err: err}
+	}
+	return id, nil
+}
+
+// parseLimit parses the limit and offset query parameters used to page
+// through lists, limit defaulting to and capped at maxLimit.
+func parseLimit(r *http.Request, maxLimit int32) (limit, offset int32, err error) {
+	limit = maxLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || n < 1 || int32(n) > maxLimit {
+			return 0, 0, &paramError{Field: "limit", Message: fmt.Sprintf("Must be between 1 and %d", maxLimit), Err: fmt.Errorf("limit %q out of range", value)}
+		}
+		limit = int32(n)
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || n < 0 {
+			return 0, 0, &paramError{Field: "offset", Message: "Must be a positive integer", Err: fmt.Errorf("offset %q out of range", value)}
+		}
+		offset = int32(n)
+	}
+	return limit, offset, nil
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return &bodyError{Err: err}
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError maps err to the status, code, message and field details it
+// should be reported to the client with.
+func classifyError(err error) (int, ErrorCode, string, []FieldError) {
+	var param *paramError
+	if errors.As(err, &param) {
+		message := param.Message
+		if message == "" {
+			message = "Must be a valid UUID"
+		}
+		return http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("Invalid %s", param.Field),
+			[]FieldError{{Field: param.Field, Message: message}}
+	}
+
+	var authErr *authError
+	if errors.As(err, &authErr) {
+		return http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid access token", nil
+	}
+
+	var account *accountError
+	if errors.As(err, &account) {
+		return http.StatusForbidden, CodeForbidden, fmt.Sprintf("Account is %s", account.Status), nil
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, CodeTooLarge,
+			fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit), nil
+	}
+
+	var body *bodyError
+	if errors.As(err, &body) {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return http.StatusBadRequest, CodeBadRequest, "Invalid request body",
+				[]FieldError{{Field: typeErr.Field, Message: fmt.Sprintf("Must be of type %s", typeErr.Type)}}
+		}
+		if errors.Is(err, io.EOF) {
+			return http.StatusBadRequest, CodeBadRequest, "Request body is empty", nil
+		}
+		return http.StatusBadRequest, CodeBadRequest, "Request body is not valid JSON", nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, CodeNotFound, "Resource not found", nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		var details []FieldError
+		if field, ok := constraintFields[pqErr.Constraint]; ok {
+			details = []FieldError{{Field: field, Message: pqErr.Message}}
+		}
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			return http.StatusConflict, CodeConflict, "Resource already exists", details
+		case pqForeignKeyViolation:
+			return http.StatusUnprocessableEntity, CodeValidation, "Referenced resource does not exist", details
+		case pqCheckViolation, pqNotNullViolation, pqStringTooLong:
+			return http.StatusUnprocessableEntity, CodeValidation, "Request violates a data constraint", details
+		case pqInvalidTextParameter:
+			return http.StatusBadRequest, CodeBadRequest, "Invalid parameter", details
+		}
+	}
+
+	return http.StatusInternalServerError, CodeInternal, "Internal server error", nil
+}
+
+// handleError logs err and reports it to the client with the status it
+// classifies as.
+func handleError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	statusCode, code, message, details := classifyError(err)
+	logger := logging.FromContext(r.Context())
+	if statusCode >= http.StatusInternalServerError {
+		logger.Error(msg, "error", err)
+	} else {
+		logger.Info(msg, "error", err, "status", statusCode)
+	}
+	respondError(w, r, statusCode, code, message, details...)
+}
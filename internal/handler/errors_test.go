@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/auth"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func decodeError(body string, v interface{}) error {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	return decodeJSON(r, v)
+}
+
+func TestClassifyError(t *testing.T) {
+	var chirp struct {
+		Body string `json:"body"`
+	}
+	_, badUUID := parseUUID("not-a-uuid", "chirpID")
+	limitReq := httptest.NewRequest(http.MethodGet, "/?limit=0", nil)
+	_, _, badLimit := parseLimit(limitReq, 50)
+
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    ErrorCode
+		message string
+		field   string
+	}{
+		{"no rows", sql.ErrNoRows, http.StatusNotFound, CodeNotFound, "Resource not found", ""},
+		{"wrapped no rows", fmt.Errorf("getting chirp: %w", sql.ErrNoRows), http.StatusNotFound, CodeNotFound, "Resource not found", ""},
+		{"unique violation", &pq.Error{Code: pqUniqueViolation}, http.StatusConflict, CodeConflict, "Resource already exists", ""},
+		{"unique email", &pq.Error{Code: pqUniqueViolation, Constraint: "users_email_key"}, http.StatusConflict, CodeConflict, "Resource already exists", "email"},
+		{"foreign key violation", &pq.Error{Code: pqForeignKeyViolation}, http.StatusUnprocessableEntity, CodeValidation, "Referenced resource does not exist", ""},
+		{"check violation", &pq.Error{Code: pqCheckViolation}, http.StatusUnprocessableEntity, CodeValidation, "Request violates a data constraint", ""},
+		{"not null violation", &pq.Error{Code: pqNotNullViolation}, http.StatusUnprocessableEntity, CodeValidation, "Request violates a data constraint", ""},
+		{"string too long", &pq.Error{Code: pqStringTooLong}, http.StatusUnprocessableEntity, CodeValidation, "Request violates a data constraint", ""},
+		{"invalid text representation", &pq.Error{Code: pqInvalidTextParameter}, http.StatusBadRequest, CodeBadRequest, "Invalid parameter", ""},
+		{"malformed JSON", decodeError("{", &chirp), http.StatusBadRequest, CodeBadRequest, "Request body is not valid JSON", ""},
+		{"empty body", decodeError("", &chirp), http.StatusBadRequest, CodeBadRequest, "Request body is empty", ""},
+		{"JSON type mismatch", decodeError(`{"body": 1}`, &chirp), http.StatusBadRequest, CodeBadRequest, "Invalid request body", "body"},
+		{"bad UUID", badUUID, http.StatusBadRequest, CodeBadRequest, "Invalid chirpID", "chirpID"},
+		{"bad limit", badLimit, http.StatusBadRequest, CodeBadRequest, "Invalid limit", "limit"},
+		{"unauthenticated", &authError{Err: errors.New("no token")}, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid access token", ""},
+		{"banned account", &accountError{Status: statusBanned}, http.StatusForbidden, CodeForbidden, "Account is banned", ""},
+		{"body too large", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, CodeTooLarge, "Request body must not exceed 10 bytes", ""},
+		{"other pq error", &pq.Error{Code: "40001"}, http.StatusInternalServerError, CodeInternal, "Internal server error", ""},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternal, "Internal server error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code, message, details := classifyError(tt.err)
+			if status != tt.status || code != tt.code || message != tt.message {
+				t.Errorf("classifyError(%v) = %d %s %q, want %d %s %q", tt.err, status, code, message, tt.status, tt.code, tt.message)
+			}
+			if tt.field == "" {
+				if len(details) != 0 {
+					t.Errorf("classifyError(%v) details = %v, want none", tt.err, details)
+				}
+				return
+			}
+			if len(details) != 1 || details[0].Field != tt.field {
+				t.Errorf("classifyError(%v) details = %v, want field %s", tt.err, details, tt.field)
+			}
+		})
+	}
+}
+
+// handlerCase is a request to a handler and the error envelope it should be
+// answered with.
+type handlerCase struct {
+	name   string
+	method string
+	path   string
+	token  string
+	body   string
+	// setup gives the database its answers.
+	setup  func(db *fakeDB)
+	status int
+	code   ErrorCode
+	fields []string
+}
+
+func runHandlerCases(t *testing.T, register func(cfg *APIConfig, mux *http.ServeMux), cases []handlerCase) {
+	t.Helper()
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			if tt.setup != nil {
+				tt.setup(db)
+			}
+			mux := http.NewServeMux()
+			register(newTestConfig(t, db), mux)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			withRequestID(mux).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body %s", rec.Code, tt.status, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+			var envelope struct {
+				Error APIError `json:"error"`
+			}
+			err := json.Unmarshal(rec.Body.Bytes(), &envelope)
+			if err != nil {
+				t.Fatalf("decoding error envelope %s: %v", rec.Body, err)
+			}
+			if envelope.Error.Code != tt.code {
+				t.Errorf("code = %s, want %s", envelope.Error.Code, tt.code)
+			}
+			if envelope.Error.Message == "" {
+				t.Error("message is empty")
+			}
+			if envelope.Error.RequestID == "" {
+				t.Error("request_id is empty")
+			}
+			fields := []string{}
+			for _, detail := range envelope.Error.Details {
+				fields = append(fields, detail.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("detail fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+// testUser is returned for users looked up by the handlers under test.
+func testUser(t *testing.T, status string) (database.User, string) {
+	t.Helper()
+	hash, err := auth.HashPassword("hunter22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		Email:          "alice@example.com",
+		HashedPassword: hash,
+		Role:           roleUser,
+		Status:         status,
+	}
+	token, err := auth.MakeJWT(user.ID, testJWTSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+func TestChirpHandlerErrors(t *testing.T) {
+	user, token := testUser(t, statusActive)
+	banned, bannedToken := testUser(t, statusBanned)
+	knownUser := func(user database.User) func(db *fakeDB) {
+		return func(db *fakeDB) {
+			db.answer("GetUser", fakeAnswer{row: userRow(user)})
+		}
+	}
+	runHandlerCases(t, func(cfg *APIConfig, mux *http.ServeMux) {
+		mux.HandleFunc("POST /api/chirps", cfg.ChirpsCreate)
+		mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.GetChirp)
+	}, []handlerCase{
+		{name: "create without token", method: http.MethodPost, path: "/api/chirps", body: `{"body": "hi"}`,
+			status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "create with a malformed token", method: http.MethodPost, path: "/api/chirps", token: "nope", body: `{"body": "hi"}`,
+			status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "create for a deleted user", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body": "hi"}`,
+			status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "create for a banned user", method: http.MethodPost, path: "/api/chirps", token: bannedToken, body: `{"body": "hi"}`,
+			setup: knownUser(banned), status: http.StatusForbidden, code: CodeForbidden},
+		{name: "create with malformed JSON", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body":`,
+			setup: knownUser(user), status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "create with a mistyped field", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body": 42}`,
+			setup: knownUser(user), status: http.StatusBadRequest, code: CodeBadRequest, fields: []string{"body"}},
+		{name: "create an empty chirp", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body": ""}`,
+			setup: knownUser(user), status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"body"}},
+		{name: "create a chirp too long", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body": "` + strings.Repeat("a", 141) + `"}`,
+			setup: knownUser(user), status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"body"}},
+		{name: "create with an unknown visibility", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body": "hi", "visibility": "friends"}`,
+			setup: knownUser(user), status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"visibility"}},
+		{name: "create hitting a check constraint", method: http.MethodPost, path: "/api/chirps", token: token, body: `{"body": "hi"}`,
+			setup: func(db *fakeDB) {
+				knownUser(user)(db)
+				db.answer("CreateChirp", fakeAnswer{err: &pq.Error{Code: pqCheckViolation}})
+			}, status: http.StatusUnprocessableEntity, code: CodeValidation},
+		{name: "get with a malformed ID", method: http.MethodGet, path: "/api/chirps/not-a-uuid",
+			status: http.StatusBadRequest, code: CodeBadRequest, fields: []string{"chirpID"}},
+		{name: "get a missing chirp", method: http.MethodGet, path: "/api/chirps/" + uuid.NewString(),
+			status: http.StatusNotFound, code: CodeNotFound},
+		{name: "get with an invalid token", method: http.MethodGet, path: "/api/chirps/" + uuid.NewString(), token: "nope",
+			status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "get failing in the database", method: http.MethodGet, path: "/api/chirps/" + uuid.NewString(),
+			setup: func(db *fakeDB) {
+				db.answer("GetVisibleChirp", fakeAnswer{err: errors.New("connection reset")})
+			}, status: http.StatusInternalServerError, code: CodeInternal},
+	})
+}
+
+func TestUserHandlerErrors(t *testing.T) {
+	user, token := testUser(t, statusActive)
+	deleting := user
+	deleting.DeleteAfter = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+	runHandlerCases(t, func(cfg *APIConfig, mux *http.ServeMux) {
+		mux.HandleFunc("POST /api/users", cfg.CreateUsers)
+		mux.HandleFunc("PUT /api/users", cfg.UpdateUsers)
+	}, []handlerCase{
+		{name: "create with malformed JSON", method: http.MethodPost, path: "/api/users", body: `not json`,
+			status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "create without a body", method: http.MethodPost, path: "/api/users",
+			status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "create without credentials", method: http.MethodPost, path: "/api/users", body: `{}`,
+			status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"email", "password"}},
+		{name: "create with an invalid email", method: http.MethodPost, path: "/api/users", body: `{"email": "alice", "password": "hunter22"}`,
+			status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"email"}},
+		{name: "create with a taken email", method: http.MethodPost, path: "/api/users", body: `{"email": "alice@example.com", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("CreateUser", fakeAnswer{err: &pq.Error{Code: pqUniqueViolation, Constraint: "users_email_key"}})
+			}, status: http.StatusConflict, code: CodeConflict, fields: []string{"email"}},
+		{name: "update without token", method: http.MethodPut, path: "/api/users", body: `{"email": "alice@example.com", "password": "hunter22"}`,
+			status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "update while pending deletion", method: http.MethodPut, path: "/api/users", token: token, body: `{"email": "alice@example.com", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(deleting)})
+			}, status: http.StatusForbidden, code: CodeForbidden},
+		{name: "update with an invalid email", method: http.MethodPut, path: "/api/users", token: token, body: `{"email": "alice", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(user)})
+			}, status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"email"}},
+		{name: "update to a taken email", method: http.MethodPut, path: "/api/users", token: token, body: `{"email": "bob@example.com", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(user)})
+				db.answer("UpdateUserCredentials", fakeAnswer{err: &pq.Error{Code: pqUniqueViolation, Constraint: "users_email_key"}})
+			}, status: http.StatusConflict, code: CodeConflict, fields: []string{"email"}},
+	})
+}
+
+func TestLoginErrors(t *testing.T) {
+	user, _ := testUser(t, statusActive)
+	suspended, _ := testUser(t, statusSuspended)
+	deleting := user
+	deleting.DeleteAfter = sql.NullTime{Time: time.Now().Add(time.Hour), Valid: true}
+	runHandlerCases(t, func(cfg *APIConfig, mux *http.ServeMux) {
+		mux.HandleFunc("POST /api/login", cfg.Login)
+	}, []handlerCase{
+		{name: "malformed JSON", method: http.MethodPost, path: "/api/login", body: `{"email"`,
+			status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "mistyped field", method: http.MethodPost, path: "/api/login", body: `{"email": "alice@example.com", "password": 1}`,
+			status: http.StatusBadRequest, code: CodeBadRequest, fields: []string{"password"}},
+		{name: "unknown email", method: http.MethodPost, path: "/api/login", body: `{"email": "nobody@example.com", "password": "hunter22"}`,
+			status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "wrong password", method: http.MethodPost, path: "/api/login", body: `{"email": "alice@example.com", "password": "wrong"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUserByEmail", fakeAnswer{row: userRow(user)})
+			}, status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "suspended account", method: http.MethodPost, path: "/api/login", body: `{"email": "alice@example.com", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUserByEmail", fakeAnswer{row: userRow(suspended)})
+			}, status: http.StatusForbidden, code: CodeForbidden},
+		{name: "refresh token not stored", method: http.MethodPost, path: "/api/login", body: `{"email": "alice@example.com", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUserByEmail", fakeAnswer{row: userRow(user)})
+				db.answer("CreateRefreshToken", fakeAnswer{err: errors.New("connection reset")})
+			}, status: http.StatusInternalServerError, code: CodeInternal},
+		// Accounts pending deletion can still log in, getting as far as
+		// issuing tokens.
+		{name: "refresh token not stored when pending deletion", method: http.MethodPost, path: "/api/login", body: `{"email": "alice@example.com", "password": "hunter22"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUserByEmail", fakeAnswer{row: userRow(deleting)})
+				db.answer("CreateRefreshToken", fakeAnswer{err: errors.New("connection reset")})
+			}, status: http.StatusInternalServerError, code: CodeInternal},
+	})
+}
+
+func TestDownloadDataExportErrors(t *testing.T) {
+	user, token := testUser(t, statusActive)
+	exportRow := func(status, path string) []driver.Value {
+		return []driver.Value{
+			uuid.NewString(), time.Now(), time.Now(), user.ID.String(), status,
+			path, nil, time.Now().Add(time.Hour),
+		}
+	}
+	knownExport := func(status, path string) func(db *fakeDB) {
+		return func(db *fakeDB) {
+			db.answer("GetUser", fakeAnswer{row: userRow(user)})
+			db.answer("GetDataExport", fakeAnswer{row: exportRow(status, path)})
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "missing.zip")
+	path := "/api/users/me/exports/" + uuid.NewString() + "/download"
+	runHandlerCases(t, func(cfg *APIConfig, mux *http.ServeMux) {
+		mux.HandleFunc("GET /api/users/me/exports/{exportID}/download", cfg.DownloadDataExport)
+	}, []handlerCase{
+		{name: "unknown export", method: http.MethodGet, path: path, token: token,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(user)})
+			}, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "export being built", method: http.MethodGet, path: path, token: token,
+			setup: knownExport("pending", ""), status: http.StatusConflict, code: CodeConflict},
+		{name: "expired export", method: http.MethodGet, path: path, token: token,
+			setup: knownExport("expired", missing), status: http.StatusGone, code: CodeGone},
+		{name: "archive missing", method: http.MethodGet, path: path, token: token,
+			setup: knownExport("ready", missing), status: http.StatusGone, code: CodeGone},
+	})
+}
+
+func TestResolveReportErrors(t *testing.T) {
+	admin, token := testUser(t, statusActive)
+	admin.Role = roleAdmin
+	reportID := uuid.New()
+	openReport := []driver.Value{
+		reportID.String(), time.Now(), time.Now(), uuid.NewString(), "user",
+		nil, uuid.NewString(), "spam", "", "open", nil, nil, nil, nil, nil,
+	}
+	path := "/admin/reports/" + reportID.String() + "/resolve"
+	runHandlerCases(t, func(cfg *APIConfig, mux *http.ServeMux) {
+		mux.Handle("POST /admin/reports/{reportID}/resolve", cfg.RequireAdmin(http.HandlerFunc(cfg.AdminResolveReport)))
+	}, []handlerCase{
+		{name: "unknown action", method: http.MethodPost, path: path, token: token, body: `{"action": "ban_user"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(admin)})
+			}, status: http.StatusUnprocessableEntity, code: CodeValidation, fields: []string{"action"}},
+		{name: "unknown report", method: http.MethodPost, path: path, token: token, body: `{"action": "dismiss"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(admin)})
+			}, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "resolved concurrently", method: http.MethodPost, path: path, token: token, body: `{"action": "dismiss"}`,
+			setup: func(db *fakeDB) {
+				db.answer("GetUser", fakeAnswer{row: userRow(admin)})
+				db.answer("GetReport", fakeAnswer{row: openReport})
+			}, status: http.StatusConflict, code: CodeConflict},
+	})
+}
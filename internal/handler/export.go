@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/jobs"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+// expireDataExportsBatch is how many expired archives are deleted per query.
+const expireDataExportsBatch = 100
+
+type DataExport struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func dataExportResponse(export database.DataExport) DataExport {
+	return DataExport{
+		ID:        export.ID,
+		CreatedAt: export.CreatedAt,
+		UpdatedAt: export.UpdatedAt,
+		Status:    export.Status,
+		ExpiresAt: nullTimePtr(export.ExpiresAt),
+	}
+}
+
+type exportSession struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func (cfg *APIConfig) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+
+	// The archive is built by a background job, clients poll the export
+	// until its status is "ready" and then download it.
+	var export database.DataExport
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		export, err = q.CreateDataExport(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		return jobs.Enqueue(r.Context(), q, jobs.Job{
+			Kind:    jobBuildDataExport,
+			Payload: dataExportJob{ExportID: export.ID, UserID: userId},
+		})
+	})
+	if err != nil {
+		handleError(w, r, "Error creating data export", err)
+		return
+	}
+
+	JsonResponse(w, http.StatusAccepted, dataExportResponse(export))
+}
+
+func (cfg *APIConfig) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := cfg.lookupDataExport(w, r)
+	if !ok {
+		return
+	}
+	JsonResponse(w, http.StatusOK, dataExportResponse(export))
+}
+
+func (cfg *APIConfig) DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	export, ok := cfg.lookupDataExport(w, r)
+	if !ok {
+		return
+	}
+	if export.Status == "expired" {
+		respondError(w, r, http.StatusGone, CodeGone, "Export has expired, request a new one")
+		return
+	}
+	if export.Status != "ready" || !export.FilePath.Valid {
+		respondError(w, r, http.StatusConflict, CodeConflict, "Export is not ready yet")
+		return
+	}
+	// Archives are written by whichever replica ran the job, so EXPORT_DIR
+	// must be shared by all of them. One missing is logged as an error as it
+	// most likely isn't.
+	file, err := os.Open(export.FilePath.String)
+	if errors.Is(err, fs.ErrNotExist) {
+		logging.FromContext(r.Context()).Error("Data export archive is missing", "export_id", export.ID, "path", export.FilePath.String)
+		respondError(w, r, http.StatusGone, CodeGone, "Export is no longer available, request a new one")
+		return
+	}
+	if err != nil {
+		handleError(w, r, "Error opening data export", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		handleError(w, r, "Error opening data export", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"chirpy-export-%s.zip\"", export.ID))
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (cfg *APIConfig) lookupDataExport(w http.ResponseWriter, r *http.Request) (database.DataExport, bool) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return database.DataExport{}, false
+	}
+	id, err := parseUUID(r.PathValue("exportID"), "exportID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return database.DataExport{}, false
+	}
+	export, err := cfg.DB.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Export not found")
+			return database.DataExport{}, false
+		}
+		handleError(w, r, "Error getting data export", err)
+		return database.DataExport{}, false
+	}
+	return export, true
+}
+
+type dataExportJob struct {
+	ExportID uuid.UUID `json:"export_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// buildDataExport writes the archive of an export. The export is marked as
+// failed once the job has no attempts left.
+func (cfg *APIConfig) buildDataExport(ctx context.Context, job dataExportJob) error {
+	path, err := cfg.writeDataExport(ctx, job.ExportID, job.UserID)
+	if err != nil {
+		if !jobs.FinalAttempt(ctx) {
+			return err
+		}
+		failErr := cfg.DB.FailDataExport(ctx, database.FailDataExportParams{
+			ID:    job.ExportID,
+			Error: sql.NullString{String: err.Error(), Valid: true},
+		})
+		return errors.Join(err, failErr)
+	}
+	return cfg.DB.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        job.ExportID,
+		FilePath:  sql.NullString{String: path, Valid: true},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(cfg.ExportTTL), Valid: true},
+	})
+}
+
+// ExpireDataExports deletes the archives of exports past their expiry and
+// marks them expired.
+func (cfg *APIConfig) ExpireDataExports(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	for {
+		exports, err := cfg.DB.ListExpiredDataExports(ctx, expireDataExportsBatch)
+		if err != nil {
+			return err
+		}
+		for _, export := range exports {
+			err = removeExportFile(export.FilePath.String)
+			if err != nil {
+				return err
+			}
+			err = cfg.DB.ExpireDataExport(ctx, export.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if len(exports) > 0 {
+			logger.Info("Expired data exports", "count", len(exports))
+		}
+		if len(exports) < expireDataExportsBatch {
+			return nil
+		}
+	}
+}
+
+// removeExportFile deletes an export archive, one already gone being fine.
+func removeExportFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (cfg *APIConfig) writeDataExport(ctx context.Context, exportID, userID uuid.UUID) (string, error) {
+	dbUser, err := cfg.DB.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	dbChirps, err := cfg.DB.GetOwnChirps(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	dbTokens, err := cfg.DB.GetRefreshTokensByUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	dbMessages, err := cfg.DB.GetSentMessages(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	dbDrafts, err := cfg.DB.ListDrafts(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	chirps := []Chirp{}
+	for _, chirp := range dbChirps {
+		chirps = append(chirps, chirpResponse(chirp))
+	}
+	messages := []Message{}
+	for _, message := range dbMessages {
+		messages = append(messages, messageResponse(message))
+	}
+	drafts := []Draft{}
+	for _, draft := range dbDrafts {
+		drafts = append(drafts, draftResponse(draft))
+	}
+	sessions := []exportSession{}
+	for _, token := range dbTokens {
+		sessions = append(sessions, exportSession{
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: nullTimePtr(token.ExpiresAt),
+			RevokedAt: nullTimePtr(token.RevokedAt),
+		})
+	}
+
+	err = os.MkdirAll(cfg.ExportDir, 0o700)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(cfg.ExportDir, exportID.String()+".zip")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	entries := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"profile.json", User{
+			ID:        dbUser.ID,
+			CreatedAt: dbUser.CreatedAt,
+			UpdatedAt: dbUser.UpdatedAt,
+			Email:     dbUser.Email,
+			ChirpyRed: dbUser.IsChirpyRed,
+			Protected: dbUser.IsProtected,
+		}},
+		{"chirps.json", chirps},
+		{"messages.json", messages},
+		{"drafts.json", drafts},
+		{"sessions.json", sessions},
+	}
+	for _, entry := range entries {
+		entryWriter, err := archive.Create(entry.name)
+		if err != nil {
+			return "", err
+		}
+		encoder := json.NewEncoder(entryWriter)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(entry.payload)
+		if err != nil {
+			return "", err
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		return "", err
+	}
+	return path, file.Close()
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
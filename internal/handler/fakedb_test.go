@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/dbtx"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/metrics"
+)
+
+const testJWTSecret = "test-secret"
+
+// fakeAnswer is what a query returns: an error, or a single row when row is
+// set and no rows otherwise.
+type fakeAnswer struct {
+	row []driver.Value
+	err error
+}
+
+// fakeDB answers the sqlc queries handlers run by name, so their error paths
+// run without Postgres. Queries without an answer return no rows and execs
+// affect none.
+type fakeDB struct {
+	mu      sync.Mutex
+	answers map[string]fakeAnswer
+	ran     []string
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{answers: map[string]fakeAnswer{}}
+}
+
+func (db *fakeDB) answer(query string, answer fakeAnswer) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.answers[query] = answer
+}
+
+func (db *fakeDB) lookup(query string) fakeAnswer {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	name := dbtx.QueryName(query)
+	db.ran = append(db.ran, name)
+	return db.answers[name]
+}
+
+// called reports whether the named query was run.
+func (db *fakeDB) called(query string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return slices.Contains(db.ran, query)
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return fakeDriver{db: db}
+}
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{db: d.db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fakedb: prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	answer := c.db.lookup(query)
+	if answer.err != nil {
+		return nil, answer.err
+	}
+	rows := &fakeRows{}
+	if answer.row != nil {
+		rows.rows = [][]driver.Value{answer.row}
+	}
+	return rows, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	answer := c.db.lookup(query)
+	if answer.err != nil {
+		return nil, answer.err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{}
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// userRow returns user as a row of the users table.
+func userRow(user database.User) []driver.Value {
+	nullTime := func(t sql.NullTime) driver.Value {
+		if !t.Valid {
+			return nil
+		}
+		return t.Time
+	}
+	return []driver.Value{
+		user.ID.String(),
+		user.CreatedAt,
+		user.UpdatedAt,
+		user.Email,
+		user.HashedPassword,
+		user.IsChirpyRed,
+		nullTime(user.DeleteAfter),
+		user.Role,
+		user.Status,
+		nullTime(user.SuspendedUntil),
+		user.IsProtected,
+	}
+}
+
+// newTestConfig returns an APIConfig backed by db.
+func newTestConfig(t *testing.T, db *fakeDB) *APIConfig {
+	t.Helper()
+	conn := sql.OpenDB(db)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return &APIConfig{
+		DB:              database.New(conn),
+		Conn:            conn,
+		Stats:           metrics.New(),
+		JWT:             testJWTSecret,
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: time.Hour,
+		MaxChirpLength:  140,
+		BannedWords:     []string{"kerfuffle"},
+	}
+}
+
+// withRequestID runs routes behind the logging middleware, which sets the
+// request ID error responses carry.
+func withRequestID(routes *http.ServeMux) http.Handler {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return logging.Middleware(logger, routes, routes)
+}
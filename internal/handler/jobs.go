@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/jobs"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+// Kinds of background jobs.
+const (
+	jobBuildDataExport    = "data_export.build"
+	jobExpireDataExports  = "data_exports.expire"
+	jobPurgeDeletedUsers  = "users.purge_deleted"
+	jobPurgeDeletedChirps = "chirps.purge_deleted"
+	jobPruneAuditEvents   = "audit_events.prune"
+	jobPruneChirpEvents   = "chirp_events.prune"
+	jobPruneJobs          = "jobs.prune"
+	jobPublishDueChirps   = "chirps.publish_due"
+	jobClosePolls         = "polls.close"
+)
+
+// jobRetention is how long finished jobs are kept for inspection.
+const jobRetention = 7 * 24 * time.Hour
+
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+func jobResponse(job database.Job) Job {
+	return Job{
+		ID:          job.ID,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+		Kind:        job.Kind,
+		Payload:     job.Payload,
+		Status:      job.Status,
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		LastError:   job.LastError.String,
+		FinishedAt:  nullTimePtr(job.FinishedAt),
+	}
+}
+
+// RegisterJobs sets up the handlers and schedules of the API's background
+// jobs on runner.
+func (cfg *APIConfig) RegisterJobs(runner *jobs.Runner) {
+	runner.Register(jobBuildDataExport, jobs.Handle(cfg.buildDataExport))
+	runner.Register(jobExpireDataExports, jobs.Task(cfg.ExpireDataExports))
+	runner.Register(jobPurgeDeletedUsers, jobs.Task(cfg.PurgeDeletedUsers))
+	runner.Register(jobPurgeDeletedChirps, jobs.Task(cfg.PurgeDeletedChirps))
+	runner.Register(jobPruneAuditEvents, jobs.Task(cfg.PruneAuditEvents))
+	runner.Register(jobPruneChirpEvents, jobs.Task(cfg.PruneChirpEvents))
+	runner.Register(jobPruneJobs, jobs.Task(cfg.PruneJobs))
+	runner.Register(jobPublishDueChirps, jobs.Task(cfg.PublishDueChirps))
+	runner.Register(jobClosePolls, jobs.Task(cfg.ClosePolls))
+
+	runner.Schedule(jobExpireDataExports, time.Hour)
+	runner.Schedule(jobPurgeDeletedUsers, time.Hour)
+	runner.Schedule(jobPurgeDeletedChirps, time.Hour)
+	runner.Schedule(jobPruneAuditEvents, time.Hour)
+	runner.Schedule(jobPruneChirpEvents, time.Hour)
+	runner.Schedule(jobPruneJobs, time.Hour)
+	runner.Schedule(jobPublishDueChirps, time.Minute)
+	runner.Schedule(jobClosePolls, time.Minute)
+}
+
+// PruneJobs drops jobs finished longer than jobRetention ago.
+func (cfg *APIConfig) PruneJobs(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	count, err := cfg.DB.PruneJobs(ctx, sql.NullTime{Time: time.Now().Add(-jobRetention), Valid: true})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Info("Pruned jobs", "count", count)
+	}
+	return nil
+}
+
+// AdminListJobs lists jobs, most recent first, filtered by the status
+// (queued, running, succeeded or failed) and kind query parameters.
+func (cfg *APIConfig) AdminListJobs(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimit(r, maxAdminPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	rows, err := cfg.DB.ListJobs(r.Context(), database.ListJobsParams{
+		Status: nullString(r.URL.Query().Get("status")),
+		Kind:   nullString(r.URL.Query().Get("kind")),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing jobs", err)
+		return
+	}
+	response := []Job{}
+	for _, row := range rows {
+		response = append(response, jobResponse(row))
+	}
+	JsonResponse(w, http.StatusOK, response)
+}
+
+func (cfg *APIConfig) AdminGetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := parseUUID(r.PathValue("jobID"), "jobID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	job, err := cfg.DB.GetJob(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Job not found")
+			return
+		}
+		handleError(w, r, "Error getting job", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, jobResponse(job))
+}
+
+// AdminRetryJob queues a failed job again right away, with a fresh set of
+// attempts.
+func (cfg *APIConfig) AdminRetryJob(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("jobID"), "jobID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	var job database.Job
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		job, err = q.RetryJob(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionJobRetry,
+			TargetType: audit.TargetJob,
+			TargetID:   audit.NullID(job.ID),
+			Details:    map[string]any{"kind": job.Kind},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Tell a missing job from one that hasn't failed.
+			_, getErr := cfg.DB.GetJob(r.Context(), id)
+			if getErr == nil {
+				respondError(w, r, http.StatusConflict, CodeConflict, "Only failed jobs can be retried")
+				return
+			}
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Job not found")
+			return
+		}
+		handleError(w, r, "Error retrying job", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, jobResponse(job))
+}
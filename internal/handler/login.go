@@ -2,65 +2,91 @@ package handler
 
 import (
 	"database/sql"
-	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/finchrelia/chirpy-server/internal/audit"
 	"github.com/finchrelia/chirpy-server/internal/auth"
 	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
 	"github.com/google/uuid"
 )
 
 func (cfg *APIConfig) Login(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	type params struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	p := params{}
-	err := decoder.Decode(&p)
+	err := decodeJSON(r, &p)
 	if err != nil {
-		log.Printf("Incorrect email or password")
-		w.WriteHeader(http.StatusUnauthorized)
+		handleError(w, r, "Error decoding parameters", err)
 		return
 	}
 
 	loggedUser, err := cfg.DB.GetUserByEmail(r.Context(), p.Email)
 	if err != nil {
-		log.Printf("Error retrieving user: %v", err)
+		logger.Info("Error retrieving user", "error", err)
+	}
+
+	// Failed attempts may not match any user, so the target is only set
+	// when the email is known.
+	failure := audit.Event{
+		Action:     audit.ActionLoginFailure,
+		TargetType: audit.TargetUser,
+		Details:    map[string]any{"email": p.Email},
+	}
+	if loggedUser.ID != uuid.Nil {
+		failure.TargetID = audit.NullID(loggedUser.ID)
 	}
 
 	err = auth.CheckPasswordHash(p.Password, loggedUser.HashedPassword)
 	if err != nil {
-		log.Printf("Incorrect email or password")
-		w.WriteHeader(http.StatusUnauthorized)
+		cfg.Stats.Logins.WithLabelValues("failure").Inc()
+		failure.Details["reason"] = "invalid_credentials"
+		cfg.recordEvent(r, failure)
+		logger.Info("Incorrect email or password")
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Incorrect email or password")
 		return
 	}
 
-	newJwt, err := auth.MakeJWT(loggedUser.ID, cfg.JWT)
+	if status := accountStatus(loggedUser); status != statusActive {
+		cfg.Stats.Logins.WithLabelValues("failure").Inc()
+		failure.Details["reason"] = "account_" + status
+		cfg.recordEvent(r, failure)
+		handleError(w, r, "Login refused", &accountError{Status: status})
+		return
+	}
+
+	if loggedUser.DeleteAfter.Valid {
+		err = cfg.DB.CancelUserDeletion(r.Context(), loggedUser.ID)
+		if err != nil {
+			handleError(w, r, "Error cancelling user deletion", err)
+			return
+		}
+	}
+
+	newJwt, err := auth.MakeJWT(loggedUser.ID, cfg.JWT, cfg.AccessTokenTTL)
 	if err != nil {
-		log.Printf("Error creating JWT: %v", newJwt)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error creating JWT", err)
 		return
 	}
 	newRefreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		log.Printf("Error creating refresh token: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error creating refresh token", err)
 		return
 	}
 
 	refreshTokenParams := database.CreateRefreshTokenParams{
 		Token:     newRefreshToken,
 		UserID:    loggedUser.ID,
-		ExpiresAt: sql.NullTime{Time: time.Now().AddDate(0, 0, 60), Valid: true},
+		ExpiresAt: sql.NullTime{Time: time.Now().Add(cfg.RefreshTokenTTL), Valid: true},
 	}
 	_, err = cfg.DB.CreateRefreshToken(r.Context(), refreshTokenParams)
 	if err != nil {
-		log.Printf("Error adding refresh token to db: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error adding refresh token to db", err)
 		return
 	}
 	type loginResponse struct {
@@ -72,6 +98,13 @@ func (cfg *APIConfig) Login(w http.ResponseWriter, r *http.Request) {
 		RefreshToken string    `json:"refresh_token"`
 		ChirpyRed    bool      `json:"is_chirpy_red"`
 	}
+	cfg.Stats.Logins.WithLabelValues("success").Inc()
+	cfg.recordEvent(r, audit.Event{
+		ActorID:    audit.NullID(loggedUser.ID),
+		Action:     audit.ActionLoginSuccess,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.NullID(loggedUser.ID),
+	})
 	JsonResponse(w, http.StatusOK, loginResponse{
 		ID:           loggedUser.ID,
 		CreatedAt:    loggedUser.CreatedAt,
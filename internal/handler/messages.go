@@ -0,0 +1,431 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+const (
+	maxMessageLength = 1000
+	// maxConversationParticipants includes the user starting the
+	// conversation.
+	maxConversationParticipants = 10
+	maxMessagePageSize          = 100
+)
+
+type Conversation struct {
+	ID           uuid.UUID     `json:"id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	CreatedBy    *uuid.UUID    `json:"created_by"`
+	Participants []Participant `json:"participants"`
+	UnreadCount  int64         `json:"unread_count,omitempty"`
+}
+
+// Participant is a member of a conversation. LastReadAt is their read
+// receipt: they have read every message sent up to then.
+type Participant struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+type Message struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+func participantResponse(participant database.ConversationParticipant) Participant {
+	return Participant{
+		UserID:     participant.UserID,
+		JoinedAt:   participant.JoinedAt,
+		LastReadAt: nullTimePtr(participant.LastReadAt),
+	}
+}
+
+func messageResponse(message database.Message) Message {
+	return Message{
+		ID:             message.ID,
+		CreatedAt:      message.CreatedAt,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Body:           message.Body,
+	}
+}
+
+func conversationResponse(conversation database.Conversation, participants []database.ConversationParticipant, unread int64) Conversation {
+	response := Conversation{
+		ID:           conversation.ID,
+		CreatedAt:    conversation.CreatedAt,
+		UpdatedAt:    conversation.UpdatedAt,
+		CreatedBy:    nullUUIDPtr(conversation.CreatedBy),
+		Participants: []Participant{},
+		UnreadCount:  unread,
+	}
+	for _, participant := range participants {
+		response.Participants = append(response.Participants, participantResponse(participant))
+	}
+	return response
+}
+
+// cleanMessage applies the chirp moderation rules to a direct message, with
+// a longer length limit.
+func (cfg *APIConfig) cleanMessage(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", errors.New("Message is empty")
+	}
+	if len(s) > maxMessageLength {
+		return "", fmt.Errorf("Message is longer than %d characters", maxMessageLength)
+	}
+	return cfg.censor(s), nil
+}
+
+// conversationFor returns the conversation named by the conversationID path
+// value if userId takes part in it.
+func (cfg *APIConfig) conversationFor(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (database.Conversation, bool) {
+	conversationId, err := parseUUID(r.PathValue("conversationID"), "conversationID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return database.Conversation{}, false
+	}
+	conversation, err := cfg.DB.GetConversationForParticipant(r.Context(), database.GetConversationForParticipantParams{
+		ID:     conversationId,
+		UserID: userId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Conversation not found")
+			return database.Conversation{}, false
+		}
+		handleError(w, r, "Error getting conversation", err)
+		return database.Conversation{}, false
+	}
+	return conversation, true
+}
+
+// blockedInConversation reports whether anyone in the conversation blocked,
+// or was blocked by, someone else in it.
+func blockedInConversation(ctx context.Context, q *database.Queries, participants []database.ConversationParticipant) (bool, error) {
+	users := make([]uuid.UUID, 0, len(participants))
+	for _, participant := range participants {
+		users = append(users, participant.UserID)
+	}
+	return blockedAmong(ctx, q, users)
+}
+
+// StartConversation starts a conversation between the caller and the users
+// in participant_ids. Starting a one-to-one conversation that already exists
+// returns it.
+func (cfg *APIConfig) StartConversation(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ParticipantIDs []uuid.UUID `json:"participant_ids"`
+	}
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	others := []uuid.UUID{}
+	for _, id := range params.ParticipantIDs {
+		if id != userId && !slices.Contains(others, id) {
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		respondValidationError(w, r, []FieldError{{Field: "participant_ids", Message: "Must name at least one other user"}})
+		return
+	}
+	if len(others) >= maxConversationParticipants {
+		respondValidationError(w, r, []FieldError{{Field: "participant_ids", Message: fmt.Sprintf("Must name at most %d users", maxConversationParticipants-1)}})
+		return
+	}
+	for _, id := range others {
+		_, err := cfg.DB.GetUser(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+				return
+			}
+			handleError(w, r, "Error getting user", err)
+			return
+		}
+		blocked, err := blockedBetween(r.Context(), cfg.DB, userId, id)
+		if err != nil {
+			handleError(w, r, "Error checking blocks", err)
+			return
+		}
+		if blocked {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+	}
+	blocked, err := blockedAmong(r.Context(), cfg.DB, others)
+	if err != nil {
+		handleError(w, r, "Error checking blocks", err)
+		return
+	}
+	if blocked {
+		respondError(w, r, http.StatusForbidden, CodeForbidden, "You cannot start a conversation with these users")
+		return
+	}
+
+	var conversation database.Conversation
+	var participants []database.ConversationParticipant
+	existing := false
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if len(others) == 1 {
+			// Starts racing for the same pair wait for each other here, so
+			// the later one finds the conversation the first created.
+			pair := database.LockDirectConversationParams{UserA: userId, UserB: others[0]}
+			err = q.LockDirectConversation(r.Context(), pair)
+			if err != nil {
+				return err
+			}
+			conversation, err = q.FindDirectConversation(r.Context(), database.FindDirectConversationParams(pair))
+			if err == nil {
+				existing = true
+				participants, err = q.ListConversationParticipants(r.Context(), conversation.ID)
+				return err
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+		conversation, err = q.CreateConversation(r.Context(), audit.NullID(userId))
+		if err != nil {
+			return err
+		}
+		for _, id := range append([]uuid.UUID{userId}, others...) {
+			err = q.AddConversationParticipant(r.Context(), database.AddConversationParticipantParams{
+				ConversationID: conversation.ID,
+				UserID:         id,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		participants, err = q.ListConversationParticipants(r.Context(), conversation.ID)
+		return err
+	})
+	if err != nil {
+		handleError(w, r, "Error starting conversation", err)
+		return
+	}
+	if existing {
+		JsonResponse(w, http.StatusOK, conversationResponse(conversation, participants, 0))
+		return
+	}
+	JsonResponse(w, http.StatusCreated, conversationResponse(conversation, participants, 0))
+}
+
+// ListConversations lists the caller's conversations, most recently active
+// first, with how many messages they haven't read in each.
+func (cfg *APIConfig) ListConversations(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	limit, offset, err := parseLimit(r, maxMessagePageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	rows, err := cfg.DB.ListConversations(r.Context(), database.ListConversationsParams{
+		UserID: userId,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing conversations", err)
+		return
+	}
+	ids := []uuid.UUID{}
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	dbParticipants, err := cfg.DB.ListParticipantsOfConversations(r.Context(), ids)
+	if err != nil {
+		handleError(w, r, "Error getting participants", err)
+		return
+	}
+	participants := map[uuid.UUID][]database.ConversationParticipant{}
+	for _, participant := range dbParticipants {
+		participants[participant.ConversationID] = append(participants[participant.ConversationID], participant)
+	}
+	conversations := []Conversation{}
+	for _, row := range rows {
+		conversation := database.Conversation{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			CreatedBy: row.CreatedBy,
+		}
+		conversations = append(conversations, conversationResponse(conversation, participants[row.ID], row.UnreadCount))
+	}
+	JsonResponse(w, http.StatusOK, conversations)
+}
+
+func (cfg *APIConfig) GetConversation(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	conversation, ok := cfg.conversationFor(w, r, userId)
+	if !ok {
+		return
+	}
+	participants, err := cfg.DB.ListConversationParticipants(r.Context(), conversation.ID)
+	if err != nil {
+		handleError(w, r, "Error getting participants", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, conversationResponse(conversation, participants, 0))
+}
+
+// SendMessage posts a message to a conversation the caller takes part in.
+// Nobody can message a conversation with someone they blocked or were
+// blocked by.
+func (cfg *APIConfig) SendMessage(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	conversation, ok := cfg.conversationFor(w, r, userId)
+	if !ok {
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	body, err := cfg.cleanMessage(params.Body)
+	if err != nil {
+		logger.Info("Invalid message", "error", err)
+		respondValidationError(w, r, []FieldError{{Field: "body", Message: err.Error()}})
+		return
+	}
+	participants, err := cfg.DB.ListConversationParticipants(r.Context(), conversation.ID)
+	if err != nil {
+		handleError(w, r, "Error getting participants", err)
+		return
+	}
+	blocked, err := blockedInConversation(r.Context(), cfg.DB, participants)
+	if err != nil {
+		handleError(w, r, "Error checking blocks", err)
+		return
+	}
+	if blocked {
+		respondError(w, r, http.StatusForbidden, CodeForbidden, "You cannot message this conversation")
+		return
+	}
+
+	var message database.Message
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		message, err = q.CreateMessage(r.Context(), database.CreateMessageParams{
+			ConversationID: conversation.ID,
+			SenderID:       userId,
+			Body:           body,
+		})
+		if err != nil {
+			return err
+		}
+		err = q.TouchConversation(r.Context(), conversation.ID)
+		if err != nil {
+			return err
+		}
+		_, err = q.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+			ConversationID: conversation.ID,
+			UserID:         userId,
+		})
+		return err
+	})
+	if err != nil {
+		handleError(w, r, "Error sending message", err)
+		return
+	}
+	JsonResponse(w, http.StatusCreated, messageResponse(message))
+}
+
+// ListMessages lists a conversation's messages, newest first, paged with the
+// limit and offset query parameters.
+func (cfg *APIConfig) ListMessages(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	conversation, ok := cfg.conversationFor(w, r, userId)
+	if !ok {
+		return
+	}
+	limit, offset, err := parseLimit(r, maxMessagePageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	dbMessages, err := cfg.DB.ListMessages(r.Context(), database.ListMessagesParams{
+		ConversationID: conversation.ID,
+		Limit:          limit,
+		Offset:         offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing messages", err)
+		return
+	}
+	messages := []Message{}
+	for _, message := range dbMessages {
+		messages = append(messages, messageResponse(message))
+	}
+	JsonResponse(w, http.StatusOK, messages)
+}
+
+// MarkConversationRead moves the caller's read receipt to now.
+func (cfg *APIConfig) MarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	conversation, ok := cfg.conversationFor(w, r, userId)
+	if !ok {
+		return
+	}
+	participant, err := cfg.DB.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: conversation.ID,
+		UserID:         userId,
+	})
+	if err != nil {
+		handleError(w, r, "Error marking conversation read", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, participantResponse(participant))
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestStartDirectConversationLocksPair(t *testing.T) {
+	user, token := testUser(t, statusActive)
+	other := uuid.New()
+	db := newFakeDB()
+	db.answer("GetUser", fakeAnswer{row: userRow(user)})
+	db.answer("IsBlockedBetween", fakeAnswer{row: []driver.Value{false}})
+	db.answer("CreateConversation", fakeAnswer{row: []driver.Value{uuid.NewString(), time.Now(), time.Now(), user.ID.String()}})
+	cfg := newTestConfig(t, db)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/conversations", strings.NewReader(`{"participant_ids": ["`+other.String()+`"]}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	cfg.StartConversation(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d, body %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	lock := slices.Index(db.ran, "LockDirectConversation")
+	find := slices.Index(db.ran, "FindDirectConversation")
+	create := slices.Index(db.ran, "CreateConversation")
+	if lock < 0 || lock > find || find > create {
+		t.Errorf("queries ran in order %v, want the pair locked before looking the conversation up and creating it", db.ran)
+	}
+}
@@ -5,23 +5,37 @@ import (
 	"net/http"
 )
 
-func (cfg *APIConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.FileserverHits.Add(1)
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (cfg *APIConfig) Metrics(w http.ResponseWriter, r *http.Request) {
+	stats := []struct {
+		label  string
+		metric string
+		value  float64
+	}{
+		{label: "Chirpy has been visited %d times!", metric: "chirpy_fileserver_hits_total"},
+		{label: "%d HTTP requests have been served.", metric: "chirpy_http_requests_total"},
+		{label: "%d chirps have been created.", metric: "chirpy_chirps_created_total"},
+		{label: "%d login attempts were made.", metric: "chirpy_logins_total"},
+	}
+	for idx, stat := range stats {
+		value, err := cfg.Stats.Value(stat.metric)
+		if err != nil {
+			handleError(w, r, "Error gathering metrics", err)
+			return
+		}
+		stats[idx].value = value
+	}
+
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
-	hits := cfg.FileserverHits.Load()
 	template := `
 		<html>
 		<body>
 			<h1>Welcome, Chirpy Admin</h1>
-			<p>Chirpy has been visited %d times!</p>
-		</body>
+%s		</body>
 		</html>`
-	w.Write([]byte(fmt.Sprintf(template, hits)))
+	paragraphs := ""
+	for _, stat := range stats {
+		paragraphs += fmt.Sprintf("\t\t\t<p>"+stat.label+"</p>\n", int64(stat.value))
+	}
+	w.Write([]byte(fmt.Sprintf(template, paragraphs)))
 }
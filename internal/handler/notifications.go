@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/notify"
+	"github.com/google/uuid"
+)
+
+const (
+	maxNotificationPageSize = 100
+	// maxMentions caps how many users a single chirp notifies.
+	maxMentions = 10
+)
+
+// mentionPattern matches @name mentions, name being the local part of a
+// user's email.
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9._%+-]+)`)
+
+type Notification struct {
+	ID         uuid.UUID   `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Kind       string      `json:"kind"`
+	TargetType string      `json:"target_type"`
+	TargetID   uuid.UUID   `json:"target_id"`
+	ActorIDs   []uuid.UUID `json:"actor_ids"`
+	Count      int32       `json:"count"`
+	Text       string      `json:"text"`
+	ReadAt     *time.Time  `json:"read_at"`
+}
+
+type NotificationFeed struct {
+	UnreadCount   int64          `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// mentionedNames returns the distinct names mentioned in body, lowercased.
+func mentionedNames(body string) []string {
+	names := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		name := strings.ToLower(strings.TrimRight(match[1], "."))
+		if name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+		if len(names) == maxMentions {
+			break
+		}
+	}
+	return names
+}
+
+// notifyMentions notifies the users mentioned in chirp who may read it.
+func (cfg *APIConfig) notifyMentions(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	names := mentionedNames(chirp.Body)
+	if len(names) == 0 {
+		return nil
+	}
+	userIds, err := q.ListMentionedUsers(ctx, database.ListMentionedUsersParams{
+		Names:      names,
+		AuthorID:   chirp.UserID,
+		Visibility: chirp.Visibility,
+	})
+	if err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		blocked, err := blockedBetween(ctx, q, chirp.UserID, userId)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			continue
+		}
+		err = notify.Notify(ctx, q, notify.Notification{
+			UserID:   userId,
+			Kind:     notify.KindMention,
+			TargetID: chirp.ID,
+			ActorID:  audit.NullID(chirp.UserID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListNotifications returns the caller's notifications, most recently
+// updated first, with their unread count. unread=true only lists unread
+// ones; limit and offset page through them.
+func (cfg *APIConfig) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	limit, offset, err := parseLimit(r, maxNotificationPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	rows, err := cfg.DB.ListNotifications(r.Context(), database.ListNotificationsParams{
+		UserID:     userId,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing notifications", err)
+		return
+	}
+	unread, err := cfg.DB.CountUnreadNotifications(r.Context(), userId)
+	if err != nil {
+		handleError(w, r, "Error counting notifications", err)
+		return
+	}
+	feed := NotificationFeed{UnreadCount: unread, Notifications: []Notification{}}
+	for _, row := range rows {
+		actor, _, _ := strings.Cut(row.LatestActorEmail.String, "@")
+		others := max(len(row.ActorIds)-1, 0)
+		actorIds := row.ActorIds
+		if actorIds == nil {
+			actorIds = []uuid.UUID{}
+		}
+		feed.Notifications = append(feed.Notifications, Notification{
+			ID:         row.ID,
+			CreatedAt:  row.CreatedAt,
+			UpdatedAt:  row.UpdatedAt,
+			Kind:       row.Kind,
+			TargetType: row.TargetType,
+			TargetID:   row.TargetID,
+			ActorIDs:   actorIds,
+			Count:      row.EventCount,
+			Text:       notify.Text(row.Kind, actor, others),
+			ReadAt:     nullTimePtr(row.ReadAt),
+		})
+	}
+	JsonResponse(w, http.StatusOK, feed)
+}
+
+func (cfg *APIConfig) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	id, err := parseUUID(r.PathValue("notificationID"), "notificationID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	marked, err := cfg.DB.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID:     id,
+		UserID: userId,
+	})
+	if err != nil {
+		handleError(w, r, "Error marking notification read", err)
+		return
+	}
+	if marked == 0 {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Notification not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *APIConfig) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	err = cfg.DB.MarkAllNotificationsRead(r.Context(), userId)
+	if err != nil {
+		handleError(w, r, "Error marking notifications read", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/notify"
+	"github.com/google/uuid"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 25
+	// Polls close between minPollDuration and maxPollDuration after their
+	// chirp is published.
+	minPollDuration = 5 * time.Minute
+	maxPollDuration = 7 * 24 * time.Hour
+	// closePollsBatch is how many polls are closed per transaction.
+	closePollsBatch = 100
+)
+
+// Poll is the poll of a chirp as seen by the viewer. Votes are only shown
+// once the viewer voted or the poll closed.
+type Poll struct {
+	ClosesAt     time.Time    `json:"closes_at"`
+	Closed       bool         `json:"closed"`
+	Options      []PollOption `json:"options"`
+	TotalVotes   *int64       `json:"total_votes,omitempty"`
+	VotedOption  *int32       `json:"voted_option"`
+	ResultsShown bool         `json:"results_shown"`
+}
+
+type PollOption struct {
+	Position int32  `json:"position"`
+	Label    string `json:"label"`
+	Votes    *int64 `json:"votes,omitempty"`
+}
+
+type pollParameters struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// validatePoll checks a poll for a chirp published at publishAt, now when
+// nil.
+func validatePoll(poll pollParameters, publishAt *time.Time) []FieldError {
+	fieldErrors := []FieldError{}
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		fieldErrors = append(fieldErrors, FieldError{Field: "poll.options", Message: fmt.Sprintf("Must hold between %d and %d options", minPollOptions, maxPollOptions)})
+	}
+	seen := []string{}
+	for i, option := range poll.Options {
+		label := strings.ToLower(strings.TrimSpace(option))
+		switch {
+		case label == "":
+			fieldErrors = append(fieldErrors, FieldError{Field: fmt.Sprintf("poll.options[%d]", i), Message: "Must not be empty"})
+		case len(option) > maxPollOptionLength:
+			fieldErrors = append(fieldErrors, FieldError{Field: fmt.Sprintf("poll.options[%d]", i), Message: fmt.Sprintf("Must be at most %d characters", maxPollOptionLength)})
+		case contains(seen, label):
+			fieldErrors = append(fieldErrors, FieldError{Field: fmt.Sprintf("poll.options[%d]", i), Message: "Must differ from the other options"})
+		}
+		seen = append(seen, label)
+	}
+	published := time.Now()
+	if publishAt != nil {
+		published = *publishAt
+	}
+	duration := poll.ClosesAt.Sub(published)
+	if duration < minPollDuration || duration > maxPollDuration {
+		fieldErrors = append(fieldErrors, FieldError{Field: "poll.closes_at", Message: "Must be between 5 minutes and 7 days after the chirp is published"})
+	}
+	return fieldErrors
+}
+
+// createPoll attaches poll to a chirp, censoring its options.
+func (cfg *APIConfig) createPoll(ctx context.Context, q *database.Queries, chirpID uuid.UUID, poll pollParameters) error {
+	err := q.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:  chirpID,
+		ClosesAt: poll.ClosesAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	for i, option := range poll.Options {
+		err = q.AddPollOption(ctx, database.AddPollOptionParams{
+			ChirpID:  chirpID,
+			Position: int32(i + 1),
+			Label:    cfg.censor(strings.TrimSpace(option)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachPolls sets the polls of chirps as seen by the viewer.
+func (cfg *APIConfig) attachPolls(ctx context.Context, chirps []Chirp, viewer uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+	rows, err := cfg.DB.ListPollOptions(ctx, database.ListPollOptionsParams{
+		ChirpIds: ids,
+		ViewerID: viewer,
+	})
+	if err != nil {
+		return err
+	}
+	polls := map[uuid.UUID]*Poll{}
+	now := time.Now()
+	for _, row := range rows {
+		poll, ok := polls[row.ChirpID]
+		if !ok {
+			poll = &Poll{
+				ClosesAt: row.ClosesAt,
+				Closed:   row.ClosedAt.Valid || !row.ClosesAt.After(now),
+				Options:  []PollOption{},
+			}
+			if row.VotedPosition.Valid {
+				poll.VotedOption = &row.VotedPosition.Int32
+			}
+			poll.ResultsShown = poll.Closed || poll.VotedOption != nil
+			if poll.ResultsShown {
+				poll.TotalVotes = new(int64)
+			}
+			polls[row.ChirpID] = poll
+		}
+		option := PollOption{Position: row.Position, Label: row.Label}
+		if poll.ResultsShown {
+			option.Votes = &row.Votes
+			*poll.TotalVotes += row.Votes
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	for i := range chirps {
+		chirps[i].Poll = polls[chirps[i].ID]
+	}
+	return nil
+}
+
+// VotePoll votes for an option of a chirp's poll, given by its position.
+// Users vote once and can't change their vote. The poll is returned with
+// its results.
+func (cfg *APIConfig) VotePoll(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Option int32 `json:"option"`
+	}
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	id, err := parseUUID(r.PathValue("chirpID"), "chirpID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	dbChirp, err := cfg.DB.GetReadableChirp(r.Context(), database.GetReadableChirpParams{
+		ID:       id,
+		ViewerID: uuid.NullUUID{UUID: userId, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp not found")
+			return
+		}
+		handleError(w, r, "Error getting chirp", err)
+		return
+	}
+	blocked, err := blockedBetween(r.Context(), cfg.DB, userId, dbChirp.UserID)
+	if err != nil {
+		handleError(w, r, "Error checking blocks", err)
+		return
+	}
+	if blocked {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp not found")
+		return
+	}
+	chirps := []Chirp{chirpResponse(dbChirp)}
+	err = cfg.attachPolls(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		handleError(w, r, "Error getting poll", err)
+		return
+	}
+	poll := chirps[0].Poll
+	if poll == nil {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp has no poll")
+		return
+	}
+	if poll.VotedOption != nil {
+		respondError(w, r, http.StatusConflict, CodeConflict, "You already voted in this poll")
+		return
+	}
+	if poll.Closed {
+		respondError(w, r, http.StatusConflict, CodeConflict, "Poll is closed")
+		return
+	}
+	if params.Option < 1 || int(params.Option) > len(poll.Options) {
+		respondValidationError(w, r, []FieldError{{Field: "option", Message: fmt.Sprintf("Must be between 1 and %d", len(poll.Options))}})
+		return
+	}
+
+	voted, err := cfg.DB.CastVote(r.Context(), database.CastVoteParams{
+		ChirpID:  id,
+		UserID:   userId,
+		Position: params.Option,
+	})
+	if err != nil {
+		handleError(w, r, "Error voting", err)
+		return
+	}
+	if voted == 0 {
+		// Voted from another request, or closed, in the meantime.
+		respondError(w, r, http.StatusConflict, CodeConflict, "Vote not recorded, you already voted or the poll closed")
+		return
+	}
+	err = cfg.attachPolls(r.Context(), chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		handleError(w, r, "Error getting poll", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, chirps[0].Poll)
+}
+
+// ClosePolls closes the polls past their closing time, recording their
+// final tallies, and tells their authors and voters.
+func (cfg *APIConfig) ClosePolls(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	for {
+		var closed []uuid.UUID
+		err := cfg.inTx(ctx, func(q *database.Queries) error {
+			var err error
+			closed, err = q.ClosePolls(ctx, closePollsBatch)
+			if err != nil || len(closed) == 0 {
+				return err
+			}
+			err = q.RecordPollTallies(ctx, closed)
+			if err != nil {
+				return err
+			}
+			for _, chirpId := range closed {
+				err = notifyPollClosed(ctx, q, chirpId)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(closed) > 0 {
+			logger.Info("Closed polls", "count", len(closed))
+		}
+		if len(closed) < closePollsBatch {
+			return nil
+		}
+	}
+}
+
+func notifyPollClosed(ctx context.Context, q *database.Queries, chirpID uuid.UUID) error {
+	chirp, err := q.GetChirp(ctx, chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Polls of deleted chirps close quietly.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = notify.Notify(ctx, q, notify.Notification{
+		UserID:   chirp.UserID,
+		Kind:     notify.KindPollClosed,
+		TargetID: chirpID,
+	})
+	if err != nil {
+		return err
+	}
+	voters, err := q.ListPollVoters(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+	for _, voter := range voters {
+		if voter == chirp.UserID {
+			continue
+		}
+		err = notify.Notify(ctx, q, notify.Notification{
+			UserID:   voter,
+			Kind:     notify.KindPollVotedClosed,
+			TargetID: chirpID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
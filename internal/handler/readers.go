@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Reader access statuses. Pending requests are waiting for the owner of the
+// protected account, approved readers see its public and readers chirps.
+const (
+	readerPending  = "pending"
+	readerApproved = "approved"
+)
+
+// Reader is an entry of a protected account's reader list.
+type Reader struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func readerResponse(access database.ReaderAccess) Reader {
+	return Reader{
+		UserID:    access.ReaderID,
+		Status:    access.Status,
+		CreatedAt: access.CreatedAt,
+		UpdatedAt: access.UpdatedAt,
+	}
+}
+
+// SetPrivacy turns protected mode on or off for the caller. Only approved
+// readers see the chirps of protected accounts.
+func (cfg *APIConfig) SetPrivacy(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Protected *bool `json:"protected"`
+	}
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	if params.Protected == nil {
+		respondValidationError(w, r, []FieldError{{Field: "protected", Message: "Is required"}})
+		return
+	}
+	user, err := cfg.DB.SetUserProtected(r.Context(), database.SetUserProtectedParams{
+		ID:          userId,
+		IsProtected: *params.Protected,
+	})
+	if err != nil {
+		handleError(w, r, "Error updating privacy", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, User{
+		ID:        user.ID,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+		Email:     user.Email,
+		ChirpyRed: user.IsChirpyRed,
+		Protected: user.IsProtected,
+	})
+}
+
+// RequestReaderAccess asks the owner of a protected account to approve the
+// caller as a reader. Asking again keeps the existing request.
+func (cfg *APIConfig) RequestReaderAccess(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	ownerId, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	if ownerId == userId {
+		respondError(w, r, http.StatusBadRequest, CodeBadRequest, "You cannot request access to your own account")
+		return
+	}
+	owner, err := cfg.DB.GetUser(r.Context(), ownerId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		handleError(w, r, "Error getting user", err)
+		return
+	}
+	blocked, err := blockedBetween(r.Context(), cfg.DB, userId, ownerId)
+	if err != nil {
+		handleError(w, r, "Error checking blocks", err)
+		return
+	}
+	if blocked {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+		return
+	}
+	if !owner.IsProtected {
+		respondError(w, r, http.StatusConflict, CodeConflict, "This account is not protected")
+		return
+	}
+	access, err := cfg.DB.RequestReaderAccess(r.Context(), database.RequestReaderAccessParams{
+		OwnerID:  ownerId,
+		ReaderID: userId,
+	})
+	if err != nil {
+		handleError(w, r, "Error requesting access", err)
+		return
+	}
+	JsonResponse(w, http.StatusAccepted, readerResponse(access))
+}
+
+// ListReaders lists the caller's readers and access requests, newest first,
+// filtered by the status query parameter.
+func (cfg *APIConfig) ListReaders(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != readerPending && status != readerApproved {
+		respondValidationError(w, r, []FieldError{{Field: "status", Message: "Must be pending or approved"}})
+		return
+	}
+	accesses, err := cfg.DB.ListReaders(r.Context(), database.ListReadersParams{
+		OwnerID: userId,
+		Status:  nullString(status),
+	})
+	if err != nil {
+		handleError(w, r, "Error listing readers", err)
+		return
+	}
+	readers := []Reader{}
+	for _, access := range accesses {
+		readers = append(readers, readerResponse(access))
+	}
+	JsonResponse(w, http.StatusOK, readers)
+}
+
+func (cfg *APIConfig) ApproveReader(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	readerId, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	access, err := cfg.DB.ApproveReader(r.Context(), database.ApproveReaderParams{
+		OwnerID:  userId,
+		ReaderID: readerId,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Access request not found")
+			return
+		}
+		handleError(w, r, "Error approving reader", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, readerResponse(access))
+}
+
+// DenyReader turns down a pending access request, or revokes the access of
+// an approved reader.
+func (cfg *APIConfig) DenyReader(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	readerId, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	removed, err := cfg.DB.RemoveReader(r.Context(), database.RemoveReaderParams{
+		OwnerID:  userId,
+		ReaderID: readerId,
+	})
+	if err != nil {
+		handleError(w, r, "Error denying reader", err)
+		return
+	}
+	if removed == 0 {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Access request not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
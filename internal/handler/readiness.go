@@ -1,9 +0,0 @@
-package handler
-
-import "net/http"
-
-func Readiness(w http.ResponseWriter, req *http.Request) {
-	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
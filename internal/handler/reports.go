@@ -0,0 +1,467 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// reportReasons are the categories a report can be filed under.
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "self_harm", "other"}
+
+const maxReportDetailsLength = 1000
+
+// How a report was resolved.
+const (
+	resolutionDismissed     = "dismissed"
+	resolutionChirpRemoved  = "chirp_removed"
+	resolutionUserSuspended = "user_suspended"
+)
+
+type Report struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ReporterID uuid.UUID  `json:"reporter_id"`
+	TargetType string     `json:"target_type"`
+	ChirpID    *uuid.UUID `json:"chirp_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	ClaimedBy  *uuid.UUID `json:"claimed_by"`
+	ClaimedAt  *time.Time `json:"claimed_at"`
+	ResolvedBy *uuid.UUID `json:"resolved_by"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Resolution string     `json:"resolution,omitempty"`
+}
+
+func reportResponse(report database.Report) Report {
+	return Report{
+		ID:         report.ID,
+		CreatedAt:  report.CreatedAt,
+		UpdatedAt:  report.UpdatedAt,
+		ReporterID: report.ReporterID,
+		TargetType: report.TargetType,
+		ChirpID:    nullUUIDPtr(report.ChirpID),
+		UserID:     report.UserID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+		ClaimedBy:  nullUUIDPtr(report.ClaimedBy),
+		ClaimedAt:  nullTimePtr(report.ClaimedAt),
+		ResolvedBy: nullUUIDPtr(report.ResolvedBy),
+		ResolvedAt: nullTimePtr(report.ResolvedAt),
+		Resolution: report.Resolution.String,
+	}
+}
+
+type reportParameters struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+func (p reportParameters) validate() []FieldError {
+	fieldErrors := []FieldError{}
+	if !contains(reportReasons, p.Reason) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "reason", Message: "Must be one of spam, harassment, hate, violence, sexual, self_harm or other"})
+	}
+	if len(p.Details) > maxReportDetailsLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "details", Message: "Must not exceed 1000 characters"})
+	}
+	return fieldErrors
+}
+
+// ReportChirp files a report against a chirp. Once enough users report the
+// same chirp it is hidden from listings until a moderator reviews it.
+func (cfg *APIConfig) ReportChirp(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	chirpId, err := parseUUID(r.PathValue("chirpID"), "chirpID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	params := reportParameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	if fieldErrors := params.validate(); len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+	// Blocks are left out: a user blocking whoever they harass must not
+	// keep them from reporting it.
+	chirp, err := cfg.DB.GetReadableChirp(r.Context(), database.GetReadableChirpParams{
+		ID:       chirpId,
+		ViewerID: audit.NullID(userId),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Chirp not found")
+			return
+		}
+		handleError(w, r, "Error getting chirp", err)
+		return
+	}
+	if chirp.UserID == userId {
+		respondError(w, r, http.StatusBadRequest, CodeBadRequest, "You cannot report your own chirp")
+		return
+	}
+
+	var report database.Report
+	hidden := false
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		report, err = q.CreateReport(r.Context(), database.CreateReportParams{
+			ReporterID: userId,
+			TargetType: audit.TargetChirp,
+			ChirpID:    audit.NullID(chirpId),
+			UserID:     chirp.UserID,
+			Reason:     params.Reason,
+			Details:    params.Details,
+		})
+		if err != nil {
+			return err
+		}
+		if cfg.ReportHideThreshold <= 0 {
+			return nil
+		}
+		reporters, err := q.CountPendingChirpReporters(r.Context(), audit.NullID(chirpId))
+		if err != nil {
+			return err
+		}
+		if reporters < int64(cfg.ReportHideThreshold) {
+			return nil
+		}
+		count, err := q.HideChirp(r.Context(), chirpId)
+		if err != nil || count == 0 {
+			return err
+		}
+		hidden = true
+		return recordAudit(r, q, audit.Event{
+			Action:     audit.ActionChirpAutoHide,
+			TargetType: audit.TargetChirp,
+			TargetID:   audit.NullID(chirpId),
+			Details:    map[string]any{"reporters": reporters},
+		})
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(w, r, http.StatusConflict, CodeConflict, "You already reported this chirp")
+			return
+		}
+		handleError(w, r, "Error creating report", err)
+		return
+	}
+	if hidden {
+		logger.Info("Chirp hidden pending review", "chirp_id", chirpId)
+	}
+	JsonResponse(w, http.StatusCreated, reportResponse(report))
+}
+
+// ReportUser files a report against a user.
+func (cfg *APIConfig) ReportUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	reportedId, err := parseUUID(r.PathValue("userID"), "userID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	params := reportParameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	if fieldErrors := params.validate(); len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+	if reportedId == userId {
+		respondError(w, r, http.StatusBadRequest, CodeBadRequest, "You cannot report yourself")
+		return
+	}
+	_, err = cfg.DB.GetUser(r.Context(), reportedId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		handleError(w, r, "Error getting user", err)
+		return
+	}
+
+	report, err := cfg.DB.CreateReport(r.Context(), database.CreateReportParams{
+		ReporterID: userId,
+		TargetType: audit.TargetUser,
+		UserID:     reportedId,
+		Reason:     params.Reason,
+		Details:    params.Details,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondError(w, r, http.StatusConflict, CodeConflict, "You already reported this user")
+			return
+		}
+		handleError(w, r, "Error creating report", err)
+		return
+	}
+	JsonResponse(w, http.StatusCreated, reportResponse(report))
+}
+
+// AdminListReports pages through the moderation queue, oldest first. It
+// defaults to reports not resolved yet, unless include_resolved is set, and
+// can be filtered with the status, target_type and reason query parameters.
+func (cfg *APIConfig) AdminListReports(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parseLimit(r, maxAdminPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	query := r.URL.Query()
+	includeResolved := false
+	if value := query.Get("include_resolved"); value != "" {
+		includeResolved, err = strconv.ParseBool(value)
+		if err != nil {
+			handleError(w, r, "Invalid include_resolved", &paramError{Field: "include_resolved", Message: "Must be true or false", Err: err})
+			return
+		}
+	}
+	dbReports, err := cfg.DB.ListReports(r.Context(), database.ListReportsParams{
+		Status:          nullString(query.Get("status")),
+		IncludeResolved: includeResolved,
+		TargetType:      nullString(query.Get("target_type")),
+		Reason:          nullString(query.Get("reason")),
+		Limit:           limit,
+		Offset:          offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing reports", err)
+		return
+	}
+	reports := []Report{}
+	for _, report := range dbReports {
+		reports = append(reports, reportResponse(report))
+	}
+	JsonResponse(w, http.StatusOK, reports)
+}
+
+// AdminClaimReport assigns a report to the calling admin, so other admins
+// know it is being looked at.
+func (cfg *APIConfig) AdminClaimReport(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("reportID"), "reportID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+
+	var report database.Report
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		report, err = q.ClaimReport(r.Context(), database.ClaimReportParams{
+			ID:        id,
+			ClaimedBy: audit.NullID(admin.ID),
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionReportClaim,
+			TargetType: audit.TargetReport,
+			TargetID:   audit.NullID(id),
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.respondReportUnavailable(w, r, id)
+		return
+	}
+	if err != nil {
+		handleError(w, r, "Error claiming report", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, reportResponse(report))
+}
+
+// AdminResolveReport closes a report, and every other pending report on the
+// same chirp or user, with one of these actions: dismiss, which makes a
+// hidden chirp visible again; remove_chirp; or suspend_user, until the
+// optional suspend_until time.
+func (cfg *APIConfig) AdminResolveReport(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	admin := adminFromContext(r.Context())
+	type parameters struct {
+		Action       string     `json:"action"`
+		Note         string     `json:"note"`
+		SuspendUntil *time.Time `json:"suspend_until"`
+	}
+	id, err := parseUUID(r.PathValue("reportID"), "reportID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	resolutions := map[string]string{
+		"dismiss":      resolutionDismissed,
+		"remove_chirp": resolutionChirpRemoved,
+		"suspend_user": resolutionUserSuspended,
+	}
+	resolution, ok := resolutions[params.Action]
+	if !ok {
+		respondValidationError(w, r, []FieldError{{Field: "action", Message: "Must be dismiss, remove_chirp or suspend_user"}})
+		return
+	}
+	if params.SuspendUntil != nil && !params.SuspendUntil.After(time.Now()) {
+		respondValidationError(w, r, []FieldError{{Field: "suspend_until", Message: "Must be in the future"}})
+		return
+	}
+
+	report, err := cfg.DB.GetReport(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Report not found")
+			return
+		}
+		handleError(w, r, "Error getting report", err)
+		return
+	}
+	if report.Status == "resolved" || (report.ClaimedBy.Valid && report.ClaimedBy.UUID != admin.ID) {
+		cfg.respondReportUnavailable(w, r, id)
+		return
+	}
+	if resolution == resolutionChirpRemoved && !report.ChirpID.Valid {
+		respondValidationError(w, r, []FieldError{{Field: "action", Message: "Only chirp reports can remove a chirp"}})
+		return
+	}
+	if resolution == resolutionUserSuspended && report.UserID == admin.ID {
+		respondError(w, r, http.StatusConflict, CodeConflict, "You cannot change the status of your own account")
+		return
+	}
+
+	var resolved []database.Report
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		// Resolve first: the report being checked above doesn't stop another
+		// admin resolving it, or another report on the same target, before
+		// this transaction. Only the first one to resolve it acts on it.
+		resolved, err = q.ResolveReportsForTarget(r.Context(), database.ResolveReportsForTargetParams{
+			ResolvedBy: audit.NullID(admin.ID),
+			Resolution: sql.NullString{String: resolution, Valid: true},
+			TargetType: report.TargetType,
+			UserID:     report.UserID,
+			ChirpID:    report.ChirpID,
+			ReportID:   id,
+		})
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(resolved, func(got database.Report) bool { return got.ID == id }) {
+			return errReportUnavailable
+		}
+		switch resolution {
+		case resolutionDismissed:
+			if report.ChirpID.Valid {
+				err = q.UnhideChirp(r.Context(), report.ChirpID.UUID)
+			}
+		case resolutionChirpRemoved:
+			var chirp takedown
+			chirp, err = takeDownChirp(r.Context(), q, report.ChirpID.UUID, admin.ID, deletionByModerator)
+			if err == nil && !chirp.ownerDeleted {
+				err = chirpWebhook(r.Context(), q, webhook.EventChirpDeleted, chirp.Chirp)
+			} else if errors.Is(err, sql.ErrNoRows) {
+				// Already taken down.
+				err = nil
+			}
+		case resolutionUserSuspended:
+			until := sql.NullTime{}
+			if params.SuspendUntil != nil {
+				until = sql.NullTime{Time: params.SuspendUntil.UTC(), Valid: true}
+			}
+			_, err = restrictUser(r.Context(), q, database.SetUserStatusParams{
+				ID:             report.UserID,
+				Status:         statusSuspended,
+				SuspendedUntil: until,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionReportResolve,
+			TargetType: audit.TargetReport,
+			TargetID:   audit.NullID(id),
+			Details: map[string]any{
+				"resolution":       resolution,
+				"note":             params.Note,
+				"reports_resolved": len(resolved),
+				"chirp_id":         nullUUIDPtr(report.ChirpID),
+				"user_id":          report.UserID,
+			},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, errReportUnavailable) {
+			cfg.respondReportUnavailable(w, r, id)
+			return
+		}
+		if errors.Is(err, errAdminTarget) {
+			respondAdminTarget(w, r)
+			return
+		}
+		handleError(w, r, "Error resolving report", err)
+		return
+	}
+	logger.Info("Resolved reports", "report_id", id, "resolution", resolution, "count", len(resolved))
+	reports := []Report{}
+	for _, report := range resolved {
+		reports = append(reports, reportResponse(report))
+	}
+	JsonResponse(w, http.StatusOK, reports)
+}
+
+// errReportUnavailable is returned when resolving a report already resolved
+// or claimed by another admin.
+var errReportUnavailable = errors.New("report is resolved or claimed by another admin")
+
+// respondReportUnavailable tells apart reports that don't exist from those
+// already resolved or claimed by another admin.
+func (cfg *APIConfig) respondReportUnavailable(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	report, err := cfg.DB.GetReport(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Report not found")
+			return
+		}
+		handleError(w, r, "Error getting report", err)
+		return
+	}
+	if report.Status == "resolved" {
+		respondError(w, r, http.StatusConflict, CodeConflict, "Report is already resolved")
+		return
+	}
+	respondError(w, r, http.StatusConflict, CodeConflict, "Report is claimed by another admin")
+}
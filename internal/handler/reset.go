@@ -1,22 +1,44 @@
 package handler
 
 import (
-	"log"
 	"net/http"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
 )
 
+// Reset deletes every non-admin user, with their chirps, and zeroes the
+// fileserver hit counter. It is only allowed on the dev platform, and admins
+// are kept so the API stays usable afterwards.
 func (cfg *APIConfig) Reset(w http.ResponseWriter, r *http.Request) {
-	cfg.FileserverHits.Store(0)
+	logger := logging.FromContext(r.Context())
 	if cfg.Platform != "dev" {
-		log.Printf("Invalid %s platform !", cfg.Platform)
-		w.WriteHeader(http.StatusForbidden)
+		logger.Warn("Reset refused on this platform", "platform", cfg.Platform)
+		respondError(w, r, http.StatusForbidden, CodeForbidden, "Reset is only allowed on the dev platform")
 		return
 	}
 
-	_, err := cfg.DB.DeleteUser(r.Context())
+	admin := adminFromContext(r.Context())
+	var deleted int64
+	err := cfg.inTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		deleted, err = q.DeleteNonAdminUsers(r.Context())
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionReset,
+			TargetType: audit.TargetSystem,
+			Details:    map[string]any{"users_deleted": deleted},
+		})
+	})
 	if err != nil {
-		log.Printf("Error deleting users: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		handleError(w, r, "Error deleting users", err)
+		return
 	}
+	cfg.Stats.ResetFileserverHits()
+	logger.Info("Reset database", "users_deleted", deleted)
 	w.WriteHeader(http.StatusOK)
 }
@@ -2,18 +2,74 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/finchrelia/chirpy-server/internal/logging"
+)
+
+type ErrorCode string
+
+const (
+	CodeBadRequest   ErrorCode = "bad_request"
+	CodeValidation   ErrorCode = "validation_failed"
+	CodeUnauthorized ErrorCode = "unauthorized"
+	CodeForbidden    ErrorCode = "forbidden"
+	CodeNotFound     ErrorCode = "not_found"
+	CodeConflict     ErrorCode = "conflict"
+	CodeGone         ErrorCode = "gone"
+	CodeTooLarge     ErrorCode = "payload_too_large"
+	CodeRateLimited  ErrorCode = "rate_limited"
+	CodeInternal     ErrorCode = "internal_error"
 )
 
+// APIError is the body of every error response, wrapped in an "error" key.
+type APIError struct {
+	Code      ErrorCode    `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError names a request field that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
 func JsonResponse(w http.ResponseWriter, statusCode int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	data, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %v", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(statusCode)
 	w.Write(data)
 }
+
+func respondError(w http.ResponseWriter, r *http.Request, statusCode int, code ErrorCode, message string, details ...FieldError) {
+	type errorResponse struct {
+		Error APIError `json:"error"`
+	}
+	JsonResponse(w, statusCode, errorResponse{
+		Error: APIError{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: logging.RequestID(r.Context()),
+		},
+	})
+}
+
+// respondValidationError rejects a request whose fields failed validation,
+// with the same 422 as constraint violations caught by the database.
+func respondValidationError(w http.ResponseWriter, r *http.Request, details []FieldError) {
+	respondError(w, r, http.StatusUnprocessableEntity, CodeValidation, "Request validation failed", details...)
+}
+
+// RateLimited is served in place of requests rejected by the rate limiter.
+func RateLimited(w http.ResponseWriter, r *http.Request) {
+	respondError(w, r, http.StatusTooManyRequests, CodeRateLimited, "Too many requests, retry later")
+}
@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/stream"
+	"github.com/google/uuid"
+)
+
+const (
+	streamHeartbeat    = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+	// maxStreamReplay caps how many missed events a resuming client is sent.
+	maxStreamReplay = 1000
+	// chirpEventRetention is how far back clients can resume from.
+	chirpEventRetention = 24 * time.Hour
+)
+
+// StreamEvent is a chirp event as sent to clients. Chirp is only set for
+// created and restored chirps.
+type StreamEvent struct {
+	ID      int64     `json:"id"`
+	Type    string    `json:"type"`
+	ChirpID uuid.UUID `json:"chirp_id"`
+	Chirp   *Chirp    `json:"chirp,omitempty"`
+}
+
+// streamFilter decides which events a stream client receives.
+type streamFilter struct {
+	viewer        uuid.NullUUID
+	hiddenAuthors map[uuid.UUID]bool
+	authorID      uuid.NullUUID
+	keyword       string
+}
+
+// visible reports whether event belongs in the client's stream. Like chirp
+// listings, it leaves out chirps the viewer may not read and those of users
+// they blocked, were blocked by or muted.
+func (cfg *APIConfig) visible(ctx context.Context, filter streamFilter, event stream.Event) (bool, error) {
+	chirp := event.Chirp
+	if filter.authorID.Valid && chirp.UserID != filter.authorID.UUID {
+		return false, nil
+	}
+	if filter.keyword != "" && !strings.Contains(strings.ToLower(chirp.Body), filter.keyword) {
+		return false, nil
+	}
+	if filter.hiddenAuthors[chirp.UserID] {
+		return false, nil
+	}
+	if event.Type != stream.TypeDeleted && chirp.HiddenAt.Valid {
+		return false, nil
+	}
+	if chirp.Visibility == "public" && !event.AuthorProtected {
+		return true, nil
+	}
+	if !filter.viewer.Valid {
+		return false, nil
+	}
+	return cfg.DB.CanViewChirp(ctx, database.CanViewChirpParams{
+		AuthorID:   chirp.UserID,
+		Visibility: chirp.Visibility,
+		ViewerID:   filter.viewer.UUID,
+	})
+}
+
+func streamEvent(event stream.Event) StreamEvent {
+	response := StreamEvent{
+		ID:      event.ID,
+		Type:    event.Type,
+		ChirpID: event.Chirp.ID,
+	}
+	if event.Type != stream.TypeDeleted {
+		chirp := chirpResponse(event.Chirp)
+		response.Chirp = &chirp
+	}
+	return response
+}
+
+// streamWriter sends events to a client over SSE or WebSocket.
+type streamWriter interface {
+	send(ctx context.Context, event StreamEvent) error
+	heartbeat(ctx context.Context) error
+}
+
+// StreamChirps pushes chirp events, created, deleted and restored chirps, to the
+// client as they happen. It speaks WebSocket when the request asks for an
+// upgrade and Server-Sent Events otherwise. The author_id and q query
+// parameters filter events by author and keyword. Clients resume after the
+// last event they received with the Last-Event-ID header or the
+// last_event_id query parameter.
+func (cfg *APIConfig) StreamChirps(w http.ResponseWriter, r *http.Request) {
+	viewerId, err := cfg.viewer(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	filter := streamFilter{
+		viewer:        viewerId,
+		hiddenAuthors: map[uuid.UUID]bool{},
+		keyword:       strings.ToLower(r.URL.Query().Get("q")),
+	}
+	if value := r.URL.Query().Get("author_id"); value != "" {
+		authorId, err := parseUUID(value, "author_id")
+		if err != nil {
+			handleError(w, r, "Incorrect author ID", err)
+			return
+		}
+		filter.authorID = uuid.NullUUID{UUID: authorId, Valid: true}
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var after int64 = -1
+	if lastEventID != "" {
+		after, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || after < 0 {
+			handleError(w, r, "Invalid last event ID", &paramError{Field: "last_event_id", Message: "Must be a positive integer", Err: err})
+			return
+		}
+	}
+	if viewerId.Valid {
+		hidden, err := cfg.DB.ListHiddenAuthors(r.Context(), viewerId.UUID)
+		if err != nil {
+			handleError(w, r, "Error listing hidden authors", err)
+			return
+		}
+		for _, id := range hidden {
+			filter.hiddenAuthors[id] = true
+		}
+	}
+
+	// Long-lived streams outlast the server timeouts, each write gets its
+	// own deadline instead.
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		handleError(w, r, "Error setting up stream", err)
+		return
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		err = rc.SetReadDeadline(time.Time{})
+		if err != nil {
+			handleError(w, r, "Error setting up stream", err)
+			return
+		}
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			// Accept already responded.
+			return
+		}
+		ctx := conn.CloseRead(r.Context())
+		lagged := cfg.runStream(ctx, &wsWriter{conn: conn}, filter, after)
+		if lagged {
+			conn.Close(websocket.StatusTryAgainLater, "client too slow, resume from the last event")
+			return
+		}
+		conn.Close(websocket.StatusGoingAway, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	err = rc.Flush()
+	if err != nil {
+		return
+	}
+	cfg.runStream(r.Context(), &sseWriter{w: w, rc: rc}, filter, after)
+}
+
+// runStream replays the events after the given ID, if not negative, then
+// sends new events and heartbeats until ctx is done, writing fails or the
+// subscription ends. It reports whether the client was dropped for not
+// keeping up.
+func (cfg *APIConfig) runStream(ctx context.Context, writer streamWriter, filter streamFilter, after int64) bool {
+	logger := logging.FromContext(ctx)
+	// Subscribe before replaying so nothing committed in between is missed.
+	sub := cfg.Stream.Subscribe()
+	defer cfg.Stream.Unsubscribe(sub)
+
+	sent := map[int64]bool{}
+	send := func(event stream.Event) error {
+		visible, err := cfg.visible(ctx, filter, event)
+		if err != nil || !visible {
+			return err
+		}
+		return writer.send(ctx, streamEvent(event))
+	}
+	if after >= 0 {
+		rows, err := cfg.DB.ListChirpEventsAfter(ctx, database.ListChirpEventsAfterParams{
+			ID:    after,
+			Limit: maxStreamReplay,
+		})
+		if err != nil {
+			logger.Error("Error replaying chirp events", "error", err)
+			return false
+		}
+		for _, row := range rows {
+			sent[row.ID] = true
+			err = send(stream.Event(row))
+			if err != nil {
+				logger.Info("Chirp stream ended", "error", err)
+				return false
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-heartbeat.C:
+			err := writer.heartbeat(ctx)
+			if err != nil {
+				logger.Info("Chirp stream ended", "error", err)
+				return false
+			}
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Lagged() {
+					logger.Info("Dropped slow chirp stream client")
+				}
+				return sub.Lagged()
+			}
+			if sent[event.ID] {
+				continue
+			}
+			err := send(event)
+			if err != nil {
+				logger.Info("Chirp stream ended", "error", err)
+				return false
+			}
+		}
+	}
+}
+
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *sseWriter) send(ctx context.Context, event StreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	err = s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) heartbeat(ctx context.Context) error {
+	err := s.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(s.w, ": heartbeat\n\n")
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+type wsWriter struct {
+	conn *websocket.Conn
+}
+
+func (ws *wsWriter) send(ctx context.Context, event StreamEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+	defer cancel()
+	return wsjson.Write(ctx, ws.conn, event)
+}
+
+func (ws *wsWriter) heartbeat(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+	defer cancel()
+	return ws.conn.Ping(ctx)
+}
+
+// PruneChirpEvents drops chirp events too old for clients to resume from.
+func (cfg *APIConfig) PruneChirpEvents(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	count, err := cfg.DB.PruneChirpEvents(ctx, time.Now().Add(-chirpEventRetention))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Info("Pruned chirp events", "count", count)
+	}
+	return nil
+}
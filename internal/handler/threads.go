@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxThreadLength caps how many chirps a thread has.
+const maxThreadLength = 25
+
+type Thread struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Chirps []Chirp   `json:"chirps"`
+}
+
+func threadResponse(chirps []database.Chirp) Thread {
+	thread := Thread{
+		ID:     chirps[0].ThreadID.UUID,
+		UserID: chirps[0].UserID,
+		Chirps: []Chirp{},
+	}
+	for _, chirp := range chirps {
+		thread.Chirps = append(thread.Chirps, chirpResponse(chirp))
+	}
+	return thread
+}
+
+// CreateThread posts bodies as a thread: each chirp replies to the previous
+// one. Every body is checked like a chirp first, and the chirps are created
+// in a single transaction so a thread is never left half posted.
+func (cfg *APIConfig) CreateThread(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Bodies     []string `json:"bodies"`
+		Visibility string   `json:"visibility"`
+	}
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	if params.Visibility == "" {
+		params.Visibility = "public"
+	}
+	fieldErrors := validatePublication(params.Visibility, nil)
+	if len(params.Bodies) < 2 || len(params.Bodies) > maxThreadLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "bodies", Message: fmt.Sprintf("Must hold between 2 and %d chirps", maxThreadLength)})
+	}
+	cleanedBodies := make([]string, len(params.Bodies))
+	for i, body := range params.Bodies {
+		cleanedBodies[i], err = cfg.cleanChirp(body)
+		if err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: fmt.Sprintf("bodies[%d]", i), Message: err.Error()})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+
+	chirps := []database.Chirp{}
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		for i, body := range cleanedBodies {
+			chirpParams := database.CreateChirpParams{
+				Body:       body,
+				UserID:     userId,
+				Visibility: params.Visibility,
+			}
+			if i > 0 {
+				chirpParams.ReplyToID = uuid.NullUUID{UUID: chirps[i-1].ID, Valid: true}
+				chirpParams.ThreadID = uuid.NullUUID{UUID: chirps[0].ID, Valid: true}
+				chirpParams.ThreadPosition = sql.NullInt32{Int32: int32(i + 1), Valid: true}
+			}
+			chirp, err := q.CreateChirp(r.Context(), chirpParams)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				chirp, err = q.StartThread(r.Context(), chirp.ID)
+				if err != nil {
+					return err
+				}
+			}
+			err = cfg.announceChirp(r.Context(), q, chirp)
+			if err != nil {
+				return err
+			}
+			chirps = append(chirps, chirp)
+		}
+		return nil
+	})
+	if err != nil {
+		handleError(w, r, "Error creating thread", err)
+		return
+	}
+	for range chirps {
+		cfg.Stats.ChirpsCreated.Inc()
+	}
+	JsonResponse(w, http.StatusCreated, threadResponse(chirps))
+}
+
+// GetThread returns the chirps of a thread in order, leaving out deleted
+// ones. Threads the viewer may not read are reported as missing.
+func (cfg *APIConfig) GetThread(w http.ResponseWriter, r *http.Request) {
+	viewerId, err := cfg.viewer(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+	id, err := parseUUID(r.PathValue("threadID"), "threadID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	chirps, err := cfg.DB.ListThreadChirps(r.Context(), database.ListThreadChirpsParams{
+		ThreadID: uuid.NullUUID{UUID: id, Valid: true},
+		ViewerID: viewerId,
+	})
+	if err != nil {
+		handleError(w, r, "Error getting thread", err)
+		return
+	}
+	if len(chirps) == 0 {
+		respondError(w, r, http.StatusNotFound, CodeNotFound, "Thread not found")
+		return
+	}
+	JsonResponse(w, http.StatusOK, threadResponse(chirps))
+}
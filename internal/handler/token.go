@@ -1,32 +1,50 @@
 package handler
 
 import (
-	"log"
+	"database/sql"
+	"errors"
 	"net/http"
 
+	"github.com/finchrelia/chirpy-server/internal/audit"
 	"github.com/finchrelia/chirpy-server/internal/auth"
+	"github.com/finchrelia/chirpy-server/internal/logging"
 )
 
 func (cfg *APIConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error extracting token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		logger.Info("Error extracting token", "error", err)
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid token")
 		return
 	}
 
 	dbUser, err := cfg.DB.GetUserFromRefreshToken(r.Context(), token)
 	if err != nil {
-		log.Printf("Error getting user: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		logger.Info("Error getting user", "error", err)
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Invalid or expired refresh token")
 		return
 	}
-	newToken, err := auth.MakeJWT(dbUser, cfg.JWT)
+	user, err := cfg.DB.GetUser(r.Context(), dbUser)
 	if err != nil {
-		log.Printf("Error creating new JWT: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error getting user", err)
 		return
 	}
+	if status := accountStatus(user); status != statusActive {
+		handleError(w, r, "Refresh refused", &accountError{Status: status})
+		return
+	}
+	newToken, err := auth.MakeJWT(dbUser, cfg.JWT, cfg.AccessTokenTTL)
+	if err != nil {
+		handleError(w, r, "Error creating new JWT", err)
+		return
+	}
+	cfg.recordEvent(r, audit.Event{
+		ActorID:    audit.NullID(dbUser),
+		Action:     audit.ActionTokenRefresh,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.NullID(dbUser),
+	})
 	type tokenResponse struct {
 		AccessToken string `json:"token"`
 	}
@@ -36,17 +54,28 @@ func (cfg *APIConfig) RefreshToken(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *APIConfig) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		log.Printf("Error extracting token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		logger.Info("Error extracting token", "error", err)
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid token")
+		return
+	}
+	userId, err := cfg.DB.RevokeRefreshToken(r.Context(), token)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Unknown tokens are as good as revoked.
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	err = cfg.DB.RevokeRefreshToken(r.Context(), token)
 	if err != nil {
-		log.Printf("Error revoking token in database: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error revoking token in database", err)
 		return
 	}
+	cfg.recordEvent(r, audit.Event{
+		ActorID:    audit.NullID(userId),
+		Action:     audit.ActionTokenRevoke,
+		TargetType: audit.TargetUser,
+		TargetID:   audit.NullID(userId),
+	})
 	w.WriteHeader(http.StatusNoContent)
 }
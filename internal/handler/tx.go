@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+)
+
+// inTx runs fn with queries bound to a single transaction, committed when fn
+// returns nil and rolled back otherwise.
+func (cfg *APIConfig) inTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = fn(cfg.DB.WithTx(tx))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
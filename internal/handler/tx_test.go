@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/dbtx"
+)
+
+func TestInTxRunsQueryHooks(t *testing.T) {
+	user, _ := testUser(t, statusActive)
+	db := newFakeDB()
+	db.answer("GetUser", fakeAnswer{row: userRow(user)})
+
+	var started, done []string
+	hook := func(ctx context.Context, query string) (context.Context, func(error)) {
+		started = append(started, dbtx.QueryName(query))
+		return ctx, func(error) {
+			done = append(done, dbtx.QueryName(query))
+		}
+	}
+	conn := sql.OpenDB(dbtx.Connector(db, hook))
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	cfg := &APIConfig{DB: database.New(conn), Conn: conn}
+
+	err := cfg.inTx(context.Background(), func(q *database.Queries) error {
+		_, err := q.GetUser(context.Background(), user.ID)
+		if err != nil {
+			return err
+		}
+		return q.CancelUserDeletion(context.Background(), user.ID)
+	})
+	if err != nil {
+		t.Fatalf("inTx: %v", err)
+	}
+	want := []string{"GetUser", "CancelUserDeletion"}
+	if !slices.Equal(started, want) || !slices.Equal(done, want) {
+		t.Errorf("hooks started %v and finished %v, want %v", started, done, want)
+	}
+}
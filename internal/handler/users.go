@@ -1,13 +1,20 @@
 package handler
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/finchrelia/chirpy-server/internal/audit"
 	"github.com/finchrelia/chirpy-server/internal/auth"
 	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/finchrelia/chirpy-server/internal/notify"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
 	"github.com/google/uuid"
 )
 
@@ -18,80 +25,103 @@ type User struct {
 	Email          string    `json:"email"`
 	HashedPassword string    `json:"-"`
 	ChirpyRed      bool      `json:"is_chirpy_red"`
+	Protected      bool      `json:"is_protected"`
 }
 
 func (cfg *APIConfig) CreateUsers(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
+	err := decodeJSON(r, &params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error decoding parameters", err)
 		return
 	}
 	defer r.Body.Close()
+	if fieldErrors := validateCredentials(params.Email, params.Password); len(fieldErrors) > 0 {
+		logger.Info("Invalid credentials", "fields", fieldErrors)
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %v", err)
+		handleError(w, r, "Error hashing password", err)
+		return
 	}
-	newDBUser, err := cfg.DB.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          params.Email,
-		HashedPassword: hashedPassword,
+	var newUser User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		newDBUser, err := q.CreateUser(r.Context(), database.CreateUserParams{
+			Email:          params.Email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			return err
+		}
+		newUser = User{
+			ID:        newDBUser.ID,
+			CreatedAt: newDBUser.CreatedAt,
+			UpdatedAt: newDBUser.UpdatedAt,
+			Email:     newDBUser.Email,
+			ChirpyRed: newDBUser.IsChirpyRed,
+			Protected: newDBUser.IsProtected,
+		}
+		return webhook.Enqueue(r.Context(), q, webhook.EventUserCreated, newUser)
 	})
 	if err != nil {
-		log.Printf("Error creating user %s: %v", params.Email, err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error creating user", err)
 		return
 	}
-	newId := newDBUser.ID
-	JsonResponse(w, http.StatusCreated, User{
-		ID:        newId,
-		CreatedAt: newDBUser.CreatedAt,
-		UpdatedAt: newDBUser.UpdatedAt,
-		Email:     newDBUser.Email,
-		ChirpyRed: newDBUser.IsChirpyRed,
-	})
+	JsonResponse(w, http.StatusCreated, newUser)
 }
 
-func (cfg *APIConfig) UpdateUsers(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("Error extracting token: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
+func validateCredentials(email, password string) []FieldError {
+	fieldErrors := []FieldError{}
+	if email == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "email", Message: "Email is required"})
+	} else if !strings.Contains(email, "@") {
+		fieldErrors = append(fieldErrors, FieldError{Field: "email", Message: "Email is not valid"})
 	}
-	userId, err := auth.ValidateJWT(token, cfg.JWT)
+	if password == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "password", Message: "Password is required"})
+	}
+	return fieldErrors
+}
+
+func (cfg *APIConfig) UpdateUsers(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	user, err := cfg.authenticateUser(r)
 	if err != nil {
-		log.Printf("Invalid JWT: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		handleError(w, r, "Unauthenticated request", err)
 		return
 	}
+	userId := user.ID
 
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err = decodeJSON(r, &params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error decoding parameters", err)
 		return
 	}
 	defer r.Body.Close()
+	if fieldErrors := validateCredentials(params.Email, params.Password); len(fieldErrors) > 0 {
+		logger.Info("Invalid credentials", "fields", fieldErrors)
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
 
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error hashing password", err)
 		return
 	}
 	credentialsQueryParams := database.UpdateUserCredentialsParams{
@@ -99,10 +129,43 @@ func (cfg *APIConfig) UpdateUsers(w http.ResponseWriter, r *http.Request) {
 		Email:          params.Email,
 		HashedPassword: hashedPassword,
 	}
-	updatedCredentials, err := cfg.DB.UpdateUserCredentials(r.Context(), credentialsQueryParams)
+	var updatedCredentials database.UpdateUserCredentialsRow
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		updatedCredentials, err = q.UpdateUserCredentials(r.Context(), credentialsQueryParams)
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(userId),
+			Action:     audit.ActionUserCredentials,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.NullID(userId),
+			Details:    map[string]any{"email_changed": params.Email != user.Email},
+		})
+		if err != nil {
+			return err
+		}
+		// Not attributed to the user, so they are told even though they
+		// made the change: it may not have been them.
+		err = notify.Notify(r.Context(), q, notify.Notification{
+			UserID:   userId,
+			Kind:     notify.KindCredentialsChanged,
+			TargetID: userId,
+		})
+		if err != nil {
+			return err
+		}
+		return webhook.Enqueue(r.Context(), q, webhook.EventUserUpdated, User{
+			ID:        userId,
+			CreatedAt: updatedCredentials.CreatedAt,
+			UpdatedAt: updatedCredentials.UpdatedAt,
+			Email:     updatedCredentials.Email,
+			ChirpyRed: updatedCredentials.IsChirpyRed,
+			Protected: updatedCredentials.IsProtected,
+		})
+	})
 	if err != nil {
-		log.Printf("Error updating user credentials: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		handleError(w, r, "Error updating user credentials", err)
 		return
 	}
 	JsonResponse(w, http.StatusOK, User{
@@ -111,26 +174,31 @@ func (cfg *APIConfig) UpdateUsers(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: updatedCredentials.UpdatedAt,
 		Email:     updatedCredentials.Email,
 		ChirpyRed: updatedCredentials.IsChirpyRed,
+		Protected: updatedCredentials.IsProtected,
 	})
 }
 
 func (cfg *APIConfig) SubscribeUser(w http.ResponseWriter, r *http.Request) {
-	_, err := auth.GetAPIKey(r.Header)
+	logger := logging.FromContext(r.Context())
+	apiKey, err := auth.GetAPIKey(r.Header)
 	if err != nil {
-		log.Printf("Error extracting apiKey: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+		logger.Info("Error extracting apiKey", "error", err)
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid API key")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.PolkaKey)) != 1 {
+		logger.Warn("Invalid Polka API key")
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid API key")
 		return
 	}
 	type parameters struct {
 		Event string            `json:"event"`
 		Data  map[string]string `json:"data"`
 	}
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err = decodeJSON(r, &params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		handleError(w, r, "Error decoding parameters", err)
 		return
 	}
 	defer r.Body.Close()
@@ -140,17 +208,138 @@ func (cfg *APIConfig) SubscribeUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	paramsUserIdString := params.Data["user_id"]
-	paramsUserId, err := uuid.Parse(paramsUserIdString)
+	paramsUserId, err := parseUUID(paramsUserIdString, "data.user_id")
 	if err != nil {
-		log.Printf("Specified user_id is not a valid UUID: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
+		handleError(w, r, "Specified user_id is not a valid UUID", err)
 		return
 	}
-	err = cfg.DB.UpgradeUser(r.Context(), paramsUserId)
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		upgraded, err := q.UpgradeUser(r.Context(), paramsUserId)
+		if err != nil {
+			return err
+		}
+		if upgraded == 0 {
+			return sql.ErrNoRows
+		}
+		err = recordAudit(r, q, audit.Event{
+			Action:     audit.ActionUserUpgradePolka,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.NullID(paramsUserId),
+			Details:    map[string]any{"source": "polka"},
+		})
+		if err != nil {
+			return err
+		}
+		err = notify.Notify(r.Context(), q, notify.Notification{
+			UserID:   paramsUserId,
+			Kind:     notify.KindRedUpgrade,
+			TargetID: paramsUserId,
+		})
+		if err != nil {
+			return err
+		}
+		return webhook.Enqueue(r.Context(), q, webhook.EventUserUpgraded, map[string]any{"user_id": paramsUserId, "source": "polka"})
+	})
 	if err != nil {
-		log.Printf("No user matches user_id given: %v", err)
-		w.WriteHeader(http.StatusNotFound)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Info("No user matches user_id given", "user_id", paramsUserId)
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "User not found")
+			return
+		}
+		handleError(w, r, "Error upgrading user", err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (cfg *APIConfig) DeleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	logger := logging.FromContext(r.Context())
+	userId, err := cfg.authenticate(r)
+	if err != nil {
+		handleError(w, r, "Unauthenticated request", err)
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	params := parameters{}
+	err = decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	defer r.Body.Close()
+
+	dbUser, err := cfg.DB.GetUser(r.Context(), userId)
+	if err != nil {
+		logger.Error("Error retrieving user", "error", err)
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid access token")
+		return
+	}
+	err = auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
+	if err != nil {
+		logger.Info("Incorrect password")
+		respondError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Incorrect password")
+		return
+	}
+
+	// The account is only flagged here; PurgeDeletedUsers removes it once
+	// the grace period is over, and logging in again before that cancels it.
+	var deleteAfter sql.NullTime
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		deleteAfter, err = q.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+			ID:          userId,
+			DeleteAfter: sql.NullTime{Time: time.Now().Add(cfg.DeletionGracePeriod), Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		err = q.RevokeUserRefreshTokens(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(userId),
+			Action:     audit.ActionUserDelete,
+			TargetType: audit.TargetUser,
+			TargetID:   audit.NullID(userId),
+			Details:    map[string]any{"delete_after": deleteAfter.Time},
+		})
+	})
+	if err != nil {
+		handleError(w, r, "Error scheduling user deletion", err)
+		return
+	}
+	type deletionResponse struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}
+	JsonResponse(w, http.StatusAccepted, deletionResponse{
+		DeleteAfter: deleteAfter.Time,
+	})
+}
+
+// PurgeDeletedUsers hard deletes accounts whose deletion grace period is
+// over, along with their export archives. Archives go first, so a failed
+// run leaves nothing on disk once retried.
+func (cfg *APIConfig) PurgeDeletedUsers(ctx context.Context) error {
+	logger := logging.FromContext(ctx)
+	paths, err := cfg.DB.ListPurgeableDataExportFiles(ctx)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		err = removeExportFile(path)
+		if err != nil {
+			return err
+		}
+	}
+	count, err := cfg.DB.PurgeDeletedUsers(ctx)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Info("Purged deleted users", "count", count)
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/audit"
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const minWebhookSecretLength = 16
+
+type Webhook struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	URL        string     `json:"url"`
+	EventTypes []string   `json:"event_types"`
+	Active     bool       `json:"active"`
+	CreatedBy  *uuid.UUID `json:"created_by"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	LastStatusCode *int32          `json:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// webhookChirp is the payload of chirp events.
+type webhookChirp struct {
+	Chirp
+	DeletionReason string `json:"deletion_reason,omitempty"`
+}
+
+// chirpWebhook queues a chirp event for the webhooks subscribed to it.
+// Integrators aren't bound by visibility, so only events about chirps
+// anyone may read at the time are sent: nothing about scheduled chirps
+// until they are published, chirps only the author or their readers may
+// see, nor any chirp of a protected account.
+func chirpWebhook(ctx context.Context, q *database.Queries, eventType string, chirp database.Chirp) error {
+	if !chirp.PublishedAt.Valid || chirp.Visibility != "public" {
+		return nil
+	}
+	author, err := q.GetUser(ctx, chirp.UserID)
+	if err != nil {
+		return err
+	}
+	if author.IsProtected {
+		return nil
+	}
+	return webhook.Enqueue(ctx, q, eventType, webhookChirp{
+		Chirp:          chirpResponse(chirp),
+		DeletionReason: chirp.DeletionReason.String,
+	})
+}
+
+func webhookResponse(hook database.Webhook) Webhook {
+	return Webhook{
+		ID:         hook.ID,
+		CreatedAt:  hook.CreatedAt,
+		UpdatedAt:  hook.UpdatedAt,
+		URL:        hook.Url,
+		EventTypes: hook.EventTypes,
+		Active:     hook.Active,
+		CreatedBy:  nullUUIDPtr(hook.CreatedBy),
+	}
+}
+
+func webhookDeliveryResponse(delivery database.WebhookDelivery) WebhookDelivery {
+	response := WebhookDelivery{
+		ID:            delivery.ID,
+		CreatedAt:     delivery.CreatedAt,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		LastAttemptAt: nullTimePtr(delivery.LastAttemptAt),
+		LastError:     delivery.LastError.String,
+		DeliveredAt:   nullTimePtr(delivery.DeliveredAt),
+	}
+	if delivery.Status == "pending" {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastStatusCode.Valid {
+		response.LastStatusCode = &delivery.LastStatusCode.Int32
+	}
+	return response
+}
+
+type webhookParameters struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+func (p webhookParameters) validate() []FieldError {
+	fieldErrors := []FieldError{}
+	target, err := url.Parse(p.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "url", Message: "Must be an absolute http or https URL"})
+	}
+	if len(p.EventTypes) == 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "event_types", Message: "Must name at least one event type"})
+	}
+	for _, eventType := range p.EventTypes {
+		if !contains(webhook.EventTypes, eventType) {
+			fieldErrors = append(fieldErrors, FieldError{Field: "event_types", Message: "Unknown event type " + eventType})
+		}
+	}
+	return fieldErrors
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// AdminCreateWebhook subscribes a URL to event types. The secret deliveries
+// are signed with is generated unless given, and only returned here.
+func (cfg *APIConfig) AdminCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	type parameters struct {
+		webhookParameters
+		Secret string `json:"secret"`
+	}
+	params := parameters{}
+	err := decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	fieldErrors := params.validate()
+	if params.Secret != "" && len(params.Secret) < minWebhookSecretLength {
+		fieldErrors = append(fieldErrors, FieldError{Field: "secret", Message: "Must be at least 16 characters"})
+	}
+	if len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+	if params.Secret == "" {
+		params.Secret, err = newWebhookSecret()
+		if err != nil {
+			handleError(w, r, "Error generating secret", err)
+			return
+		}
+	}
+
+	var hook database.Webhook
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		hook, err = q.CreateWebhook(r.Context(), database.CreateWebhookParams{
+			Url:        params.URL,
+			EventTypes: params.EventTypes,
+			Secret:     params.Secret,
+			CreatedBy:  audit.NullID(admin.ID),
+		})
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionWebhookCreate,
+			TargetType: audit.TargetWebhook,
+			TargetID:   audit.NullID(hook.ID),
+			Details:    map[string]any{"url": hook.Url, "event_types": hook.EventTypes},
+		})
+		if err != nil {
+			return err
+		}
+		return webhook.Ping(r.Context(), q, hook)
+	})
+	if err != nil {
+		handleError(w, r, "Error creating webhook", err)
+		return
+	}
+	response := webhookResponse(hook)
+	response.Secret = hook.Secret
+	JsonResponse(w, http.StatusCreated, response)
+}
+
+func (cfg *APIConfig) AdminListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := cfg.DB.ListWebhooks(r.Context())
+	if err != nil {
+		handleError(w, r, "Error listing webhooks", err)
+		return
+	}
+	response := []Webhook{}
+	for _, hook := range hooks {
+		response = append(response, webhookResponse(hook))
+	}
+	JsonResponse(w, http.StatusOK, response)
+}
+
+// lookupWebhook returns the webhook named by the webhookID path value.
+func (cfg *APIConfig) lookupWebhook(w http.ResponseWriter, r *http.Request) (database.Webhook, bool) {
+	id, err := parseUUID(r.PathValue("webhookID"), "webhookID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return database.Webhook{}, false
+	}
+	hook, err := cfg.DB.GetWebhook(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Webhook not found")
+			return database.Webhook{}, false
+		}
+		handleError(w, r, "Error getting webhook", err)
+		return database.Webhook{}, false
+	}
+	return hook, true
+}
+
+func (cfg *APIConfig) AdminGetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := cfg.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+	JsonResponse(w, http.StatusOK, webhookResponse(hook))
+}
+
+// AdminUpdateWebhook changes a webhook URL and event types, and pauses or
+// resumes it with active. Active webhooks are pinged after the change.
+func (cfg *APIConfig) AdminUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	hook, ok := cfg.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+	type parameters struct {
+		webhookParameters
+		Active *bool `json:"active"`
+	}
+	params := parameters{}
+	err := decodeJSON(r, &params)
+	if err != nil {
+		handleError(w, r, "Error decoding parameters", err)
+		return
+	}
+	if fieldErrors := params.validate(); len(fieldErrors) > 0 {
+		respondValidationError(w, r, fieldErrors)
+		return
+	}
+	active := hook.Active
+	if params.Active != nil {
+		active = *params.Active
+	}
+
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		hook, err = q.UpdateWebhook(r.Context(), database.UpdateWebhookParams{
+			ID:         hook.ID,
+			Url:        params.URL,
+			EventTypes: params.EventTypes,
+			Active:     active,
+		})
+		if err != nil {
+			return err
+		}
+		err = recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionWebhookUpdate,
+			TargetType: audit.TargetWebhook,
+			TargetID:   audit.NullID(hook.ID),
+			Details:    map[string]any{"url": hook.Url, "event_types": hook.EventTypes, "active": hook.Active},
+		})
+		if err != nil {
+			return err
+		}
+		return webhook.Ping(r.Context(), q, hook)
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Webhook not found")
+			return
+		}
+		handleError(w, r, "Error updating webhook", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, webhookResponse(hook))
+}
+
+// AdminDeleteWebhook deletes a webhook along with its delivery log.
+func (cfg *APIConfig) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	id, err := parseUUID(r.PathValue("webhookID"), "webhookID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		deleted, err := q.DeleteWebhook(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return sql.ErrNoRows
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionWebhookDelete,
+			TargetType: audit.TargetWebhook,
+			TargetID:   audit.NullID(id),
+		})
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Webhook not found")
+			return
+		}
+		handleError(w, r, "Error deleting webhook", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminListWebhookDeliveries is a webhook's delivery log, newest first,
+// filtered by the status query parameter: pending, delivered or dead.
+func (cfg *APIConfig) AdminListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := cfg.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+	limit, offset, err := parseLimit(r, maxAdminPageSize)
+	if err != nil {
+		handleError(w, r, "Invalid pagination", err)
+		return
+	}
+	deliveries, err := cfg.DB.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		WebhookID: hook.ID,
+		Status:    nullString(r.URL.Query().Get("status")),
+		Limit:     limit,
+		Offset:    offset,
+	})
+	if err != nil {
+		handleError(w, r, "Error listing webhook deliveries", err)
+		return
+	}
+	response := []WebhookDelivery{}
+	for _, delivery := range deliveries {
+		response = append(response, webhookDeliveryResponse(delivery))
+	}
+	JsonResponse(w, http.StatusOK, response)
+}
+
+// AdminRedeliverWebhook queues a delivery to be sent again right away, with
+// a fresh set of attempts, whatever its status.
+func (cfg *APIConfig) AdminRedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	admin := adminFromContext(r.Context())
+	hook, ok := cfg.lookupWebhook(w, r)
+	if !ok {
+		return
+	}
+	deliveryId, err := parseUUID(r.PathValue("deliveryID"), "deliveryID")
+	if err != nil {
+		handleError(w, r, "Not a valid ID", err)
+		return
+	}
+	var delivery database.WebhookDelivery
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		delivery, err = q.RedeliverWebhookDelivery(r.Context(), database.RedeliverWebhookDeliveryParams{
+			ID:        deliveryId,
+			WebhookID: hook.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return recordAudit(r, q, audit.Event{
+			ActorID:    audit.NullID(admin.ID),
+			Action:     audit.ActionWebhookRedeliver,
+			TargetType: audit.TargetWebhook,
+			TargetID:   audit.NullID(hook.ID),
+			Details:    map[string]any{"delivery_id": deliveryId},
+		})
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(w, r, http.StatusNotFound, CodeNotFound, "Delivery not found")
+			return
+		}
+		handleError(w, r, "Error redelivering webhook", err)
+		return
+	}
+	JsonResponse(w, http.StatusOK, webhookDeliveryResponse(delivery))
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/webhook"
+	"github.com/google/uuid"
+)
+
+func TestChirpWebhookVisibility(t *testing.T) {
+	published := sql.NullTime{Time: time.Now(), Valid: true}
+	tests := []struct {
+		name       string
+		chirp      database.Chirp
+		protected  bool
+		wantQueued bool
+	}{
+		{"public", database.Chirp{Visibility: "public", PublishedAt: published}, false, true},
+		{"protected author", database.Chirp{Visibility: "public", PublishedAt: published}, true, false},
+		{"readers only", database.Chirp{Visibility: "readers", PublishedAt: published}, false, false},
+		{"scheduled", database.Chirp{Visibility: "public"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _ := testUser(t, statusActive)
+			user.IsProtected = tt.protected
+			db := newFakeDB()
+			db.answer("GetUser", fakeAnswer{row: userRow(user)})
+			cfg := newTestConfig(t, db)
+
+			chirp := tt.chirp
+			chirp.ID = uuid.New()
+			chirp.UserID = user.ID
+			err := chirpWebhook(context.Background(), cfg.DB, webhook.EventChirpCreated, chirp)
+			if err != nil {
+				t.Fatalf("chirpWebhook: %v", err)
+			}
+			if queued := db.called("EnqueueWebhookDeliveries"); queued != tt.wantQueued {
+				t.Errorf("queued = %v, want %v", queued, tt.wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"os"
+)
+
+// PingDB checks the database accepts connections.
+func PingDB(db *sql.DB) CheckFunc {
+	return db.PingContext
+}
+
+// WritableDir checks files can be created in dir, such as the directory data
+// exports are written to.
+func WritableDir(dir string) CheckFunc {
+	return func(ctx context.Context) error {
+		err := os.MkdirAll(dir, 0o700)
+		if err != nil {
+			return err
+		}
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}
+}
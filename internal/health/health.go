@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/logging"
+)
+
+// CheckFunc probes one dependency, returning an error when it is unusable.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker serves the liveness and readiness endpoints. Readiness runs every
+// registered check and fails while the server is draining.
+type Checker struct {
+	timeout  time.Duration
+	checks   []check
+	draining atomic.Bool
+}
+
+// New returns a Checker that gives each check at most timeout to complete.
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a readiness check. It must be called before serving.
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Drain marks the server as shutting down, so load balancers stop routing
+// new requests to it while in-flight ones complete.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// CheckResult is the outcome of a check. Only its status is served, the
+// endpoints being unauthenticated; the rest is logged.
+type CheckResult struct {
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"-"`
+	Error    error         `json:"-"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusFailing     = "failing"
+	statusUnavailable = "unavailable"
+	statusDraining    = "draining"
+)
+
+// Live reports the process is up. It checks no dependency, so a database
+// outage doesn't get the server restarted.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, Report{Status: statusOK})
+}
+
+// Ready runs every check concurrently and reports the status of each,
+// answering 503 when any fails or the server is draining. Check errors are
+// logged rather than served.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	report := c.Run(r.Context())
+	statusCode := http.StatusOK
+	if report.Status != statusOK {
+		statusCode = http.StatusServiceUnavailable
+		logger := logging.FromContext(r.Context())
+		for name, result := range report.Checks {
+			if result.Error != nil {
+				logger.Warn("Readiness check failing", "check", name, "duration", result.Duration, "error", result.Error)
+			}
+		}
+		logger.Warn("Not ready", "status", report.Status)
+	}
+	writeReport(w, statusCode, report)
+}
+
+// Run executes the checks and returns their report.
+func (c *Checker) Run(ctx context.Context) Report {
+	report := Report{Status: statusOK, Checks: map[string]CheckResult{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, chk := range c.checks {
+		wg.Add(1)
+		go func(chk check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+			start := time.Now()
+			err := chk.fn(checkCtx)
+			result := CheckResult{Status: statusOK, Duration: time.Since(start)}
+			if err != nil {
+				result.Status = statusFailing
+				result.Error = err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[chk.name] = result
+			if err != nil {
+				report.Status = statusUnavailable
+			}
+		}(chk)
+	}
+	wg.Wait()
+	if c.draining.Load() {
+		report.Status = statusDraining
+	}
+	return report
+}
+
+func writeReport(w http.ResponseWriter, statusCode int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		slog.Error("Error writing health report", "error", err)
+	}
+}
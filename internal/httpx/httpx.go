@@ -0,0 +1,128 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Router resolves the pattern a request is routed to, *http.ServeMux
+// satisfies it.
+type Router interface {
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+// Route returns the pattern routes matches r with, or "unmatched".
+func Route(routes Router, r *http.Request) string {
+	_, route := routes.Handler(r)
+	if route == "" {
+		return "unmatched"
+	}
+	return route
+}
+
+// StatusRecorder remembers the status code and size of a response.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int
+	wroteHeader bool
+}
+
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *StatusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack lets WebSocket upgrades take over the connection.
+func (r *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// LimitBody caps request bodies to n bytes, reading past it fails with an
+// *http.MaxBytesError.
+func LimitBody(n int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+type clientIPKey struct{}
+
+// TrustProxies makes ClientIP honour X-Forwarded-For on requests coming
+// from one of proxies. The client is the rightmost forwarded address that
+// is not a proxy itself, earlier ones being set by the client at will.
+func TrustProxies(proxies []netip.Prefix, next http.Handler) http.Handler {
+	if len(proxies) == 0 {
+		return next
+	}
+	trusted := func(addr netip.Addr) bool {
+		for _, proxy := range proxies {
+			if proxy.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := netip.ParseAddr(remoteHost(r))
+		if err != nil || !trusted(peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := peer
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+			if err != nil {
+				break
+			}
+			client = addr.Unmap()
+			if !trusted(client) {
+				break
+			}
+		}
+		ctx := context.WithValue(r.Context(), clientIPKey{}, client.String())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ClientIP returns the address of the client, forwarded by a trusted proxy
+// or else the host part of the request remote address.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return strings.TrimSpace(r.RemoteAddr)
+	}
+	return host
+}
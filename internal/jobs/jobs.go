@@ -0,0 +1,262 @@
+// Package jobs runs background work from the jobs table. Jobs are queued in
+// the transaction that needs them done, so they are only run if it commits,
+// then claimed by the runners of every replica with FOR UPDATE SKIP LOCKED,
+// and retried with exponential backoff until they succeed or fail for good.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"runtime/debug"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a job is tried unless it says
+	// otherwise.
+	DefaultMaxAttempts = 5
+	firstBackoff       = 10 * time.Second
+	maxBackoff         = time.Hour
+	// pollInterval is how often runners look for due jobs when idle.
+	pollInterval = time.Second
+	// timeout bounds a single run of a job.
+	timeout = 10 * time.Minute
+	// lease is how long a claimed job is left alone by other runners. It
+	// outlasts timeout so only jobs whose runner died are claimed again.
+	lease = timeout + time.Minute
+)
+
+// Handler runs a job given its JSON payload. Returning an error retries the
+// job later, unless it was its last attempt.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Handle adapts fn, taking the payload decoded as a T, to a Handler.
+func Handle[T any](fn func(context.Context, T) error) Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var args T
+		err := json.Unmarshal(payload, &args)
+		if err != nil {
+			return fmt.Errorf("decoding payload: %w", err)
+		}
+		return fn(ctx, args)
+	}
+}
+
+// Task adapts fn, which takes no payload, to a Handler.
+func Task(fn func(context.Context) error) Handler {
+	return func(ctx context.Context, _ json.RawMessage) error {
+		return fn(ctx)
+	}
+}
+
+// Job is a job to queue.
+type Job struct {
+	Kind    string
+	Payload any
+	// RunAt delays the job, it runs right away when zero.
+	RunAt time.Time
+	// UniqueKey, if set, keeps the job from being queued again while a job
+	// with the same key is in the table.
+	UniqueKey   string
+	MaxAttempts int
+}
+
+// Enqueue queues job. Pass the queries of the transaction needing it done,
+// so it is only run if the transaction commits.
+func Enqueue(ctx context.Context, db *database.Queries, job Job) error {
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return err
+	}
+	runAt := job.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	_, err = db.EnqueueJob(ctx, database.EnqueueJobParams{
+		Kind:        job.Kind,
+		Payload:     payload,
+		UniqueKey:   sql.NullString{String: job.UniqueKey, Valid: job.UniqueKey != ""},
+		MaxAttempts: int32(maxAttempts),
+		RunAt:       runAt,
+	})
+	return err
+}
+
+// Backoff returns how long to wait before trying a job that failed attempts
+// times again: doubling from 10 seconds up to an hour, with some jitter.
+func Backoff(attempts int) time.Duration {
+	backoff := maxBackoff
+	if attempts < 1 {
+		backoff = firstBackoff
+	} else if attempts < 20 {
+		backoff = min(firstBackoff<<(attempts-1), maxBackoff)
+	}
+	return backoff + rand.N(backoff/10+1)
+}
+
+type attemptKey struct{}
+
+// FinalAttempt reports whether the job run with ctx won't be retried if it
+// fails, so its handler can record the failure.
+func FinalAttempt(ctx context.Context) bool {
+	job, ok := ctx.Value(attemptKey{}).(database.Job)
+	return ok && job.Attempts >= job.MaxAttempts
+}
+
+type schedule struct {
+	kind  string
+	every time.Duration
+}
+
+// Runner runs queued jobs with the handlers registered for their kind.
+type Runner struct {
+	db          *database.Queries
+	concurrency int
+	handlers    map[string]Handler
+	schedules   []schedule
+}
+
+// NewRunner returns a runner running up to concurrency jobs at once.
+func NewRunner(db *database.Queries, concurrency int) *Runner {
+	return &Runner{
+		db:          db,
+		concurrency: concurrency,
+		handlers:    map[string]Handler{},
+	}
+}
+
+// Register sets the handler of kind jobs. Call it before Run.
+func (r *Runner) Register(kind string, handler Handler) {
+	r.handlers[kind] = handler
+}
+
+// Schedule queues a kind job, with no payload, every interval. Runs are
+// aligned on multiples of every, so replicas queue each run only once
+// between them. Call it before Run.
+func (r *Runner) Schedule(kind string, every time.Duration) {
+	r.schedules = append(r.schedules, schedule{kind: kind, every: every})
+}
+
+// Run runs jobs until ctx is done, then waits for the jobs it started to
+// finish. Jobs aren't cancelled with ctx, a job still running when the
+// process exits is claimed again once its lease runs out.
+func (r *Runner) Run(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	for _, s := range r.schedules {
+		go r.runSchedule(ctx, s)
+	}
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	finished := make(chan struct{})
+	active := 0
+	for {
+		if active < r.concurrency && ctx.Err() == nil {
+			claimed, err := r.db.ClaimJobs(ctx, database.ClaimJobsParams{
+				LeaseUntil: time.Now().Add(lease),
+				Batch:      int32(r.concurrency - active),
+			})
+			if err != nil && ctx.Err() == nil {
+				logger.Error("Error claiming jobs", "error", err)
+			}
+			for _, job := range claimed {
+				active++
+				go func() {
+					r.run(context.WithoutCancel(ctx), job)
+					finished <- struct{}{}
+				}()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if active > 0 {
+				logger.Info("Waiting for running jobs", "count", active)
+			}
+			for ; active > 0; active-- {
+				<-finished
+			}
+			return
+		case <-finished:
+			active--
+		case <-poll.C:
+		}
+	}
+}
+
+func (r *Runner) runSchedule(ctx context.Context, s schedule) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(s.every)
+	defer ticker.Stop()
+	for {
+		slot := time.Now().Truncate(s.every)
+		err := Enqueue(ctx, r.db, Job{
+			Kind:      s.kind,
+			Payload:   struct{}{},
+			RunAt:     slot,
+			UniqueKey: fmt.Sprintf("%s@%d", s.kind, slot.Unix()),
+		})
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Error scheduling job", "kind", s.kind, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) run(ctx context.Context, job database.Job) {
+	logger := logging.FromContext(ctx).With("job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+	ctx = logging.WithLogger(ctx, logger)
+	start := time.Now()
+	err := r.handle(ctx, job)
+	if err == nil {
+		logger.Debug("Job succeeded", "duration", time.Since(start))
+		err = r.db.CompleteJob(ctx, job.ID)
+		if err != nil {
+			logger.Error("Error completing job", "error", err)
+		}
+		return
+	}
+
+	if job.Attempts >= job.MaxAttempts {
+		logger.Error("Job failed", "duration", time.Since(start), "error", err)
+	} else {
+		logger.Warn("Job failed, will retry", "duration", time.Since(start), "error", err)
+	}
+	err = r.db.FailJob(ctx, database.FailJobParams{
+		ID:        job.ID,
+		Error:     err.Error(),
+		NextRunAt: time.Now().Add(Backoff(int(job.Attempts))),
+	})
+	if err != nil {
+		logger.Error("Error recording job failure", "error", err)
+	}
+}
+
+// handle runs job with its handler, turning panics into errors.
+func (r *Runner) handle(ctx context.Context, job database.Job) (err error) {
+	handler, ok := r.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for %s jobs", job.Kind)
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, attemptKey{}, job), timeout)
+	defer cancel()
+	return handler(ctx, job.Payload)
+}
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/httpx"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestKey
+)
+
+// requestInfo carries what handlers learn about a request back up to the
+// access log.
+type requestInfo struct {
+	mu     sync.Mutex
+	id     string
+	userID uuid.UUID
+}
+
+// New builds a logger writing to w. level is one of debug, info, warn or
+// error and format is json or text.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be json or text", format)
+	}
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the request scoped logger, or the default one outside
+// of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(loggerKey).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+	return logger
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	info, ok := ctx.Value(requestKey).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
+
+// SetUserID records the authenticated user for the access log.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	info, ok := ctx.Value(requestKey).(*requestInfo)
+	if !ok {
+		return
+	}
+	info.mu.Lock()
+	info.userID = userID
+	info.mu.Unlock()
+}
+
+// Middleware gives every request an ID and a logger carrying it, and writes
+// one access log line once next is done.
+func Middleware(logger *slog.Logger, routes httpx.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		info := &requestInfo{id: requestID}
+		requestLogger := logger.With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.HasTraceID() {
+			requestLogger = requestLogger.With("trace_id", spanContext.TraceID().String())
+		}
+		ctx := context.WithValue(r.Context(), requestKey, info)
+		ctx = WithLogger(ctx, requestLogger)
+
+		recorder := httpx.NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		attrs := []any{
+			"method", r.Method,
+			"route", httpx.Route(routes, r),
+			"path", r.URL.Path,
+			"status", recorder.Status,
+			"bytes", recorder.Bytes,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		}
+		info.mu.Lock()
+		if info.userID != uuid.Nil {
+			attrs = append(attrs, "user_id", info.userID)
+		}
+		info.mu.Unlock()
+		level := slog.LevelInfo
+		if recorder.Status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		requestLogger.Log(ctx, level, "request", attrs...)
+	})
+}
+
+// validRequestID accepts IDs from upstream proxies as long as they are short
+// and printable, so they can't be used to forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/dbtx"
+)
+
+// QueryHook times every query run on a dbtx connection.
+func (m *Metrics) QueryHook() dbtx.Hook {
+	return func(ctx context.Context, query string) (context.Context, func(error)) {
+		start := time.Now()
+		return ctx, func(err error) {
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+			m.queryLatency.WithLabelValues(dbtx.QueryName(query), result).Observe(time.Since(start).Seconds())
+		}
+	}
+}
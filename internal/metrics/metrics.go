@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/httpx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chirpy"
+
+// Metrics owns the Prometheus registry every Chirpy metric is registered on.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	Logins        *prometheus.CounterVec
+	ChirpsCreated prometheus.Counter
+
+	requests       *prometheus.CounterVec
+	requestLatency *prometheus.HistogramVec
+	queryLatency   *prometheus.HistogramVec
+	fileserverHits *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps created.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route and status.",
+		}, []string{"method", "route", "status"}),
+		requestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		queryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query latency by sqlc query name.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"query", "result"}),
+		fileserverHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fileserver_hits_total",
+			Help:      "Requests served by the /app/ file server since the last reset.",
+		}, nil),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Logins,
+		m.ChirpsCreated,
+		m.requests,
+		m.requestLatency,
+		m.queryLatency,
+		m.fileserverHits,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware records the count and latency of every request served by next,
+// labelled with the pattern routes matched it with.
+func (m *Metrics) Middleware(routes httpx.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httpx.NewStatusRecorder(w)
+		next.ServeHTTP(recorder, r)
+
+		route := httpx.Route(routes, r)
+		status := strconv.Itoa(recorder.Status)
+		m.requests.WithLabelValues(r.Method, route, status).Inc()
+		m.requestLatency.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// MiddlewareFileserverHits counts requests to the file server.
+func (m *Metrics) MiddlewareFileserverHits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.fileserverHits.WithLabelValues().Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Metrics) ResetFileserverHits() {
+	m.fileserverHits.Reset()
+}
+
+// Value sums every sample of the named counter or gauge currently held by the
+// registry.
+func (m *Metrics) Value(name string) (float64, error) {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.Counter != nil:
+				total += metric.Counter.GetValue()
+			case metric.Gauge != nil:
+				total += metric.Gauge.GetValue()
+			}
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,118 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Kind is a type of notification. Adding one only takes a new Kind value
+// registered with newKind: Notify and the feed handle every kind alike.
+type Kind struct {
+	Name       string
+	TargetType string
+	Grouping   Grouping
+	// Text renders a notification given the name of the latest user who
+	// caused it, empty when there is none, and how many others did too.
+	Text func(actor string, others int) string
+}
+
+// Grouping tells which unread notifications of a kind are merged into one.
+type Grouping int
+
+const (
+	// GroupByTarget merges notifications on the same target.
+	GroupByTarget Grouping = iota
+	// GroupByUser merges every notification of the kind its user hasn't
+	// read, the latest target being kept. It suits kinds whose targets only
+	// ever have one actor, such as a chirp mentioning someone.
+	GroupByUser
+)
+
+// Kinds of notifications.
+var (
+	KindMention            = newKind("mention", "chirp", GroupByUser, byActors("mentioned you"))
+	KindRedUpgrade         = newKind("red_upgrade", "user", GroupByTarget, fixed("Your account was upgraded to Chirpy Red"))
+	KindCredentialsChanged = newKind("credentials_changed", "user", GroupByTarget, fixed("Your email or password was changed"))
+	KindPollClosed         = newKind("poll_closed", "chirp", GroupByTarget, fixed("Your poll has closed, see the results"))
+	KindPollVotedClosed    = newKind("poll_voted_closed", "chirp", GroupByTarget, fixed("A poll you voted in has closed, see the results"))
+)
+
+var kinds = map[string]Kind{}
+
+func newKind(name, targetType string, grouping Grouping, text func(string, int) string) Kind {
+	kind := Kind{Name: name, TargetType: targetType, Grouping: grouping, Text: text}
+	kinds[name] = kind
+	return kind
+}
+
+// byActors renders notifications caused by users as "alice and 4 others
+// <action>".
+func byActors(action string) func(string, int) string {
+	return func(actor string, others int) string {
+		if actor == "" {
+			actor = "Someone"
+		}
+		switch others {
+		case 0:
+			return fmt.Sprintf("%s %s", actor, action)
+		case 1:
+			return fmt.Sprintf("%s and 1 other %s", actor, action)
+		default:
+			return fmt.Sprintf("%s and %d others %s", actor, others, action)
+		}
+	}
+}
+
+func fixed(text string) func(string, int) string {
+	return func(string, int) string {
+		return text
+	}
+}
+
+// Text renders a stored notification of the named kind.
+func Text(kind, actor string, others int) string {
+	k, ok := kinds[kind]
+	if !ok {
+		return ""
+	}
+	return k.Text(actor, others)
+}
+
+// Notification tells UserID about something that happened to TargetID.
+// ActorID is who caused it, if anyone.
+type Notification struct {
+	UserID   uuid.UUID
+	Kind     Kind
+	TargetID uuid.UUID
+	ActorID  uuid.NullUUID
+}
+
+// Notify adds n to its user's feed, grouping it with an unread notification
+// of the same kind as its Grouping tells. Users aren't notified of their own
+// actions. Pass the queries of the transaction making the change, so the
+// notification is only sent if the change commits.
+func Notify(ctx context.Context, db *database.Queries, n Notification) error {
+	if n.ActorID.Valid && n.ActorID.UUID == n.UserID {
+		return nil
+	}
+	return db.AddNotification(ctx, database.AddNotificationParams{
+		UserID:     n.UserID,
+		Kind:       n.Kind.Name,
+		TargetType: n.Kind.TargetType,
+		TargetID:   n.TargetID,
+		GroupID:    groupID(n),
+		ActorID:    n.ActorID,
+	})
+}
+
+// groupID returns the ID n shares with the unread notifications it is
+// merged with.
+func groupID(n Notification) uuid.UUID {
+	if n.Kind.Grouping == GroupByUser {
+		return n.UserID
+	}
+	return n.TargetID
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// feed stands in for the notifications table, merging added notifications
+// the way AddNotification's ON CONFLICT clause does.
+type feed struct {
+	groups map[groupKey]*group
+}
+
+type groupKey struct {
+	user  uuid.UUID
+	kind  string
+	group uuid.UUID
+}
+
+type group struct {
+	target uuid.UUID
+	actors []uuid.UUID
+	count  int
+}
+
+func (f *feed) ExecContext(_ context.Context, _ string, args ...interface{}) (sql.Result, error) {
+	key := groupKey{user: args[0].(uuid.UUID), kind: args[1].(string), group: args[4].(uuid.UUID)}
+	actor := args[5].(uuid.NullUUID)
+	g, ok := f.groups[key]
+	if !ok {
+		g = &group{}
+		f.groups[key] = g
+	}
+	g.target = args[3].(uuid.UUID)
+	g.count++
+	if actor.Valid {
+		actors := []uuid.UUID{actor.UUID}
+		for _, id := range g.actors {
+			if id != actor.UUID {
+				actors = append(actors, id)
+			}
+		}
+		g.actors = actors
+	}
+	return nil, nil
+}
+
+func (f *feed) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (f *feed) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (f *feed) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestNotifyGrouping(t *testing.T) {
+	user := uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+	chirpA, chirpB := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name          string
+		notifications []Notification
+		// groups is how many notifications the user ends up with, and text
+		// how the latest one reads given its latest actor is "alice".
+		groups int
+		target uuid.UUID
+		text   string
+	}{
+		{
+			name: "mentions in different chirps",
+			notifications: []Notification{
+				{UserID: user, Kind: KindMention, TargetID: chirpA, ActorID: uuid.NullUUID{UUID: bob, Valid: true}},
+				{UserID: user, Kind: KindMention, TargetID: chirpB, ActorID: uuid.NullUUID{UUID: alice, Valid: true}},
+			},
+			groups: 1,
+			target: chirpB,
+			text:   "alice and 1 other mentioned you",
+		},
+		{
+			name: "mentions by the same user",
+			notifications: []Notification{
+				{UserID: user, Kind: KindMention, TargetID: chirpA, ActorID: uuid.NullUUID{UUID: alice, Valid: true}},
+				{UserID: user, Kind: KindMention, TargetID: chirpB, ActorID: uuid.NullUUID{UUID: alice, Valid: true}},
+			},
+			groups: 1,
+			target: chirpB,
+			text:   "alice mentioned you",
+		},
+		{
+			name: "polls closing",
+			notifications: []Notification{
+				{UserID: user, Kind: KindPollClosed, TargetID: chirpA},
+				{UserID: user, Kind: KindPollClosed, TargetID: chirpB},
+			},
+			groups: 2,
+			target: chirpB,
+			text:   "Your poll has closed, see the results",
+		},
+		{
+			name: "own mention",
+			notifications: []Notification{
+				{UserID: user, Kind: KindMention, TargetID: chirpA, ActorID: uuid.NullUUID{UUID: user, Valid: true}},
+			},
+			groups: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &feed{groups: map[groupKey]*group{}}
+			for _, n := range tt.notifications {
+				err := Notify(context.Background(), database.New(f), n)
+				if err != nil {
+					t.Fatalf("Notify: %v", err)
+				}
+			}
+			if len(f.groups) != tt.groups {
+				t.Fatalf("got %d notifications, want %d", len(f.groups), tt.groups)
+			}
+			if tt.groups == 0 {
+				return
+			}
+			last := tt.notifications[len(tt.notifications)-1]
+			g := f.groups[groupKey{user: user, kind: last.Kind.Name, group: groupID(last)}]
+			if g.target != tt.target {
+				t.Errorf("target = %v, want %v", g.target, tt.target)
+			}
+			text := Text(last.Kind.Name, "alice", max(len(g.actors)-1, 0))
+			if text != tt.text {
+				t.Errorf("text = %q, want %q", text, tt.text)
+			}
+		})
+	}
+}
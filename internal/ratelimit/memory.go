@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	capacity  float64
+	rate      float64
+}
+
+// MemoryStore keeps buckets in process memory. Limits are only enforced per
+// replica, use PostgresStore to share them.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, capacity, rate float64) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.capacity = capacity
+	b.rate = rate
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updatedAt).Seconds()*rate)
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+// sweep drops buckets that have refilled completely, they are equivalent to
+// a missing one.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*b.rate >= b.capacity {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// replica enforces the same limits.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, capacity, rate float64) (float64, bool, error) {
+	row, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:      key,
+		Capacity: capacity,
+		Rate:     rate,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return row.Tokens, row.Allowed, nil
+}
+
+// Prune removes buckets untouched for a day, they have long been refilled.
+func (s *PostgresStore) Prune(ctx context.Context) error {
+	_, err := s.db.PruneRateLimitBuckets(ctx, time.Now().Add(-24*time.Hour))
+	return err
+}
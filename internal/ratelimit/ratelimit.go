@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/auth"
+	"github.com/finchrelia/chirpy-server/internal/httpx"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+)
+
+// Policy describes a token bucket: Burst requests are allowed at once and
+// the bucket refills at Burst tokens per Period.
+type Policy struct {
+	Name   string
+	Burst  int
+	Period time.Duration
+}
+
+func (p Policy) rate() float64 {
+	return float64(p.Burst) / p.Period.Seconds()
+}
+
+// Store takes a token from the bucket identified by key, refilling it first.
+// It reports the tokens left afterwards and whether a token was available.
+type Store interface {
+	Take(ctx context.Context, key string, capacity, rate float64) (tokens float64, allowed bool, err error)
+}
+
+// KeyFunc identifies the client a request is accounted to.
+type KeyFunc func(r *http.Request) string
+
+type Limiter struct {
+	store  Store
+	key    KeyFunc
+	reject http.Handler
+}
+
+// New returns a Limiter taking tokens from store. Rejected requests are
+// answered by reject once the rate limit headers are set.
+func New(store Store, key KeyFunc, reject http.Handler) *Limiter {
+	return &Limiter{
+		store:  store,
+		key:    key,
+		reject: reject,
+	}
+}
+
+// Limit enforces policy on next. Every response carries RateLimit-* headers,
+// rejected requests get a 429 with Retry-After.
+func (l *Limiter) Limit(policy Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := policy.Name + ":" + l.key(r)
+		tokens, allowed, err := l.store.Take(r.Context(), key, float64(policy.Burst), policy.rate())
+		if err != nil {
+			// Failing open: a broken store should not take the API down.
+			logging.FromContext(r.Context()).Error("Error taking rate limit token", "key", key, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rate := policy.rate()
+		resetIn := time.Duration((float64(policy.Burst) - tokens) / rate * float64(time.Second))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(resetIn)))
+		w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, ceilSeconds(policy.Period)))
+		if !allowed {
+			retryAfter := time.Duration((1 - tokens) / rate * float64(time.Second))
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+			l.reject.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyByIP accounts requests to the client address.
+func KeyByIP(r *http.Request) string {
+	return "ip:" + httpx.ClientIP(r)
+}
+
+// KeyByUserOrIP accounts requests carrying a valid JWT to the user, and
+// anonymous ones to the client address.
+func KeyByUserOrIP(jwtSecret string) KeyFunc {
+	return func(r *http.Request) string {
+		token, err := auth.GetBearerToken(r.Header)
+		if err == nil {
+			userId, err := auth.ValidateJWT(token, jwtSecret)
+			if err == nil {
+				return "user:" + userId.String()
+			}
+		}
+		return KeyByIP(r)
+	}
+}
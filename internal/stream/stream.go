@@ -0,0 +1,197 @@
+// Package stream fans chirp events out to live subscribers. Events are
+// logged in the chirp_events table by a trigger and announced with Postgres
+// NOTIFY when their transaction commits, so every replica sees the changes
+// made on any of them. Their IDs are positions given in commit order, so
+// catching up or resuming after an ID never skips an event committed late.
+package stream
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/lib/pq"
+)
+
+// Channel is the Postgres channel chirp events are announced on.
+const Channel = "chirp_events"
+
+// Types of chirp events.
+const (
+	TypeCreated  = "created"
+	TypeDeleted  = "deleted"
+	TypeRestored = "restored"
+)
+
+// catchUpBatch is how many events are read at once when catching up after
+// the listener lost its connection.
+const catchUpBatch = 500
+
+// Event is a change to a chirp, with the chirp as it is now. Its ID is its
+// position in the log.
+type Event struct {
+	ID              int64
+	Type            string
+	Chirp           database.Chirp
+	AuthorProtected bool
+}
+
+// Subscription receives the events published after it was made. Its
+// channel is closed when the hub stops or when the subscriber falls too far
+// behind, see Lagged.
+type Subscription struct {
+	events chan Event
+	lagged bool
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Lagged reports whether the subscription was dropped for not keeping up.
+// Only valid once its channel is closed.
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// Hub listens for chirp events and publishes them to its subscriptions.
+type Hub struct {
+	db     *database.Queries
+	buffer int
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewHub returns a hub reading events with db. Each subscription buffers up
+// to buffer events; a subscriber that lets it fill up is dropped rather than
+// slowing down the others, and resumes from the log when it reconnects.
+func NewHub(db *database.Queries, buffer int) *Hub {
+	return &Hub{
+		db:     db,
+		buffer: buffer,
+		subs:   map[*Subscription]struct{}{},
+	}
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	sub := &Subscription{events: make(chan Event, h.buffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+func (h *Hub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		select {
+		case sub.events <- event:
+		default:
+			sub.lagged = true
+			delete(h.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+func (h *Hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Run listens for events on dbURL until ctx is done, then closes every
+// subscription.
+func (h *Hub) Run(ctx context.Context, dbURL string) error {
+	logger := logging.FromContext(ctx)
+	defer h.close()
+
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("Chirp event listener connection problem", "error", err)
+		}
+	})
+	defer listener.Close()
+	err := listener.Listen(Channel)
+	if err != nil {
+		return err
+	}
+	lastID, err := h.db.GetLatestChirpEventID(ctx)
+	if err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ping.C:
+			go listener.Ping()
+		case notification := <-listener.Notify:
+			// A nil notification means the listener reconnected and may
+			// have missed some.
+			if notification == nil {
+				lastID = h.catchUp(ctx, lastID)
+				continue
+			}
+			id, err := strconv.ParseInt(notification.Extra, 10, 64)
+			if err != nil {
+				logger.Error("Invalid chirp event notification", "payload", notification.Extra)
+				continue
+			}
+			row, err := h.db.GetChirpEvent(ctx, id)
+			if err != nil {
+				logger.Error("Error getting chirp event", "id", id, "error", err)
+				continue
+			}
+			h.publish(Event(row))
+			lastID = max(lastID, id)
+		}
+	}
+}
+
+func (h *Hub) catchUp(ctx context.Context, lastID int64) int64 {
+	logger := logging.FromContext(ctx)
+	for {
+		rows, err := h.db.ListChirpEventsAfter(ctx, database.ListChirpEventsAfterParams{
+			ID:    lastID,
+			Limit: catchUpBatch,
+		})
+		if err != nil {
+			logger.Error("Error catching up on chirp events", "error", err)
+			return lastID
+		}
+		for _, row := range rows {
+			h.publish(Event(row))
+			lastID = row.ID
+		}
+		if len(rows) < catchUpBatch {
+			return lastID
+		}
+	}
+}
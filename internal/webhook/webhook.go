@@ -0,0 +1,257 @@
+// Package webhook tells integrators about Chirpy activity. Events are
+// written to the webhook_deliveries outbox in the transaction making the
+// change, then a Dispatcher sends them, signed with each webhook's secret,
+// and retries failures with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/finchrelia/chirpy-server/internal/logging"
+	"github.com/google/uuid"
+)
+
+// Event types webhooks can subscribe to.
+const (
+	EventChirpCreated  = "chirp.created"
+	EventChirpDeleted  = "chirp.deleted"
+	EventChirpRestored = "chirp.restored"
+	EventUserCreated   = "user.created"
+	EventUserUpdated   = "user.updated"
+	EventUserUpgraded  = "user.upgraded"
+)
+
+// EventPing is sent to a webhook whenever it is created or changed, so its
+// receiver can be checked right away. It needs no subscription.
+const EventPing = "webhook.ping"
+
+var EventTypes = []string{
+	EventChirpCreated,
+	EventChirpDeleted,
+	EventChirpRestored,
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserUpgraded,
+}
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the webhook secret.
+const (
+	HeaderEvent     = "X-Chirpy-Event"
+	HeaderDelivery  = "X-Chirpy-Delivery"
+	HeaderTimestamp = "X-Chirpy-Timestamp"
+	HeaderSignature = "X-Chirpy-Signature"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is dead.
+	MaxAttempts  = 10
+	firstBackoff = 30 * time.Second
+	maxBackoff   = 6 * time.Hour
+	batchSize    = 20
+	sendTimeout  = 10 * time.Second
+	// lease is how long a claimed delivery is left alone by other replicas.
+	lease = time.Minute
+)
+
+// envelope is the body of a delivery.
+type envelope struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Enqueue adds a delivery of an event to every webhook subscribed to
+// eventType. Pass the queries of the transaction making the change, so the
+// event is only sent if the change commits.
+func Enqueue(ctx context.Context, db *database.Queries, eventType string, data any) error {
+	return enqueue(ctx, db, eventType, data, uuid.NullUUID{})
+}
+
+// Ping adds a ping delivery for the webhook.
+func Ping(ctx context.Context, db *database.Queries, webhook database.Webhook) error {
+	data := map[string]any{"webhook_id": webhook.ID, "event_types": webhook.EventTypes}
+	return enqueue(ctx, db, EventPing, data, uuid.NullUUID{UUID: webhook.ID, Valid: true})
+}
+
+func enqueue(ctx context.Context, db *database.Queries, eventType string, data any, webhookID uuid.NullUUID) error {
+	event := envelope{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: eventType,
+		Payload:   payload,
+		WebhookID: webhookID,
+	})
+}
+
+// Sign returns the signature of a delivery body sent at timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait before the next try of a delivery that
+// failed attempts times: doubling from 30 seconds up to 6 hours, with some
+// jitter so failed deliveries don't all come back at once.
+func Backoff(attempts int) time.Duration {
+	backoff := maxBackoff
+	if attempts < 1 {
+		backoff = firstBackoff
+	} else if attempts < 20 {
+		backoff = min(firstBackoff<<(attempts-1), maxBackoff)
+	}
+	return backoff + rand.N(backoff/10+1)
+}
+
+// Dispatcher sends due deliveries from the outbox.
+type Dispatcher struct {
+	db     *database.Queries
+	client *http.Client
+}
+
+func NewDispatcher(db *database.Queries) *Dispatcher {
+	return &Dispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout: sendTimeout,
+			// Redirects are reported as failures rather than followed.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run sends due deliveries every interval until ctx is done. It then stops
+// claiming deliveries and returns once the send in flight, if any, is
+// recorded; claimed deliveries it didn't get to are sent again once their
+// lease runs out.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := d.Deliver(ctx)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Error delivering webhooks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver sends the due deliveries, batch after batch, until none are left
+// or ctx is done. Sends aren't cut short by ctx, so their outcome is always
+// recorded. Failed deliveries are recorded for retry rather than returned;
+// only failing to claim deliveries is an error.
+func (d *Dispatcher) Deliver(ctx context.Context) error {
+	sendCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		deliveries, err := d.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+			LeaseUntil: time.Now().Add(lease),
+			Batch:      batchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("claiming webhook deliveries: %w", err)
+		}
+		for _, delivery := range deliveries {
+			if ctx.Err() != nil {
+				return nil
+			}
+			d.attempt(sendCtx, delivery)
+		}
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) {
+	logger := logging.FromContext(ctx).With("delivery_id", delivery.ID, "webhook_id", delivery.WebhookID)
+	status, err := d.send(ctx, delivery)
+	if err == nil {
+		err = d.db.RecordWebhookDelivered(ctx, database.RecordWebhookDeliveredParams{
+			ID:             delivery.ID,
+			LastStatusCode: status,
+		})
+		if err != nil {
+			logger.Error("Error recording webhook delivery", "error", err)
+		}
+		return
+	}
+
+	attempts := int(delivery.Attempts) + 1
+	if attempts >= MaxAttempts {
+		logger.Warn("Webhook delivery is dead", "attempts", attempts, "error", err)
+	} else {
+		logger.Info("Webhook delivery failed", "attempts", attempts, "error", err)
+	}
+	err = d.db.RecordWebhookFailure(ctx, database.RecordWebhookFailureParams{
+		ID:            delivery.ID,
+		MaxAttempts:   MaxAttempts,
+		StatusCode:    status,
+		Error:         err.Error(),
+		NextAttemptAt: time.Now().Add(Backoff(attempts)),
+	})
+	if err != nil {
+		logger.Error("Error recording webhook failure", "error", err)
+	}
+}
+
+// send posts delivery to its webhook. It returns the response status, if
+// any, and an error unless the receiver answered with a 2xx.
+func (d *Dispatcher) send(ctx context.Context, delivery database.ClaimWebhookDeliveriesRow) (sql.NullInt32, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return sql.NullInt32{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return sql.NullInt32{}, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	status := sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return status, errors.New("unexpected status " + resp.Status)
+	}
+	return status, nil
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/finchrelia/chirpy-server/internal/database"
+	"github.com/google/uuid"
+)
+
+func testDelivery(url string) database.ClaimWebhookDeliveriesRow {
+	return database.ClaimWebhookDeliveriesRow{
+		ID:        uuid.New(),
+		WebhookID: uuid.New(),
+		EventID:   uuid.New(),
+		EventType: EventChirpCreated,
+		Payload:   []byte(`{"type":"chirp.created"}`),
+		Url:       url,
+		Secret:    "webhook-secret",
+	}
+}
+
+func TestSendSignsDelivery(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	delivery := testDelivery(server.URL)
+	status, err := NewDispatcher(nil).send(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if !status.Valid || status.Int32 != http.StatusNoContent {
+		t.Errorf("status = %v, want 204", status)
+	}
+	if string(body) != string(delivery.Payload) {
+		t.Errorf("body = %s, want %s", body, delivery.Payload)
+	}
+	if event := got.Header.Get(HeaderEvent); event != delivery.EventType {
+		t.Errorf("%s = %q, want %q", HeaderEvent, event, delivery.EventType)
+	}
+	if id := got.Header.Get(HeaderDelivery); id != delivery.ID.String() {
+		t.Errorf("%s = %q, want %q", HeaderDelivery, id, delivery.ID)
+	}
+	timestamp, err := strconv.ParseInt(got.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("%s: %v", HeaderTimestamp, err)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age < 0 || age > time.Minute {
+		t.Errorf("%s is %v old", HeaderTimestamp, age)
+	}
+	if signature := got.Header.Get(HeaderSignature); signature != Sign(delivery.Secret, timestamp, body) {
+		t.Errorf("%s = %q does not verify", HeaderSignature, signature)
+	}
+	if Sign("other-secret", timestamp, body) == Sign(delivery.Secret, timestamp, body) {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int32
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}, http.StatusInternalServerError},
+		{"client error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusGone)
+		}, http.StatusGone},
+		{"redirect", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		}, http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+
+			status, err := NewDispatcher(nil).send(context.Background(), testDelivery(server.URL))
+			if err == nil {
+				t.Fatal("send succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), strconv.Itoa(int(tt.status))) {
+				t.Errorf("error %q does not carry status %d", err, tt.status)
+			}
+			if !status.Valid || status.Int32 != tt.status {
+				t.Errorf("status = %v, want %d", status, tt.status)
+			}
+			if requests != 1 {
+				t.Errorf("receiver got %d requests, want 1", requests)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		base     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, 512 * 30 * time.Second},
+		{11, 6 * time.Hour},
+		{19, 6 * time.Hour},
+		{64, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			for range 100 {
+				backoff := Backoff(tt.attempts)
+				if backoff < tt.base || backoff > tt.base+tt.base/10 {
+					t.Fatalf("Backoff(%d) = %v, want between %v and %v", tt.attempts, backoff, tt.base, tt.base+tt.base/10)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		// A nil database would panic if Run claimed deliveries.
+		NewDispatcher(nil).Run(ctx, time.Hour)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return once its context was cancelled")
+	}
+}
@@ -0,0 +1,46 @@
+-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM user_blocks
+WHERE blocker_id = $1
+AND blocked_id = $2;
+
+-- name: ListBlockedUsers :many
+SELECT * FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.arg('user_a') AND blocked_id = sqlc.arg('user_b'))
+    OR (blocker_id = sqlc.arg('user_b') AND blocked_id = sqlc.arg('user_a'))
+);
+
+-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :exec
+DELETE FROM user_mutes
+WHERE muter_id = $1
+AND muted_id = $2;
+
+-- name: ListMutedUsers :many
+SELECT * FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC;
+
+-- Authors whose chirps a user's listings leave out: those they blocked, were
+-- blocked by or muted.
+
+-- name: ListHiddenAuthors :many
+SELECT b1.blocked_id AS user_id FROM user_blocks b1 WHERE b1.blocker_id = sqlc.arg('user_id')
+UNION
+SELECT b2.blocker_id AS user_id FROM user_blocks b2 WHERE b2.blocked_id = sqlc.arg('user_id')
+UNION
+SELECT m.muted_id AS user_id FROM user_mutes m WHERE m.muter_id = sqlc.arg('user_id');
@@ -0,0 +1,25 @@
+-- name: GetChirpEvent :one
+SELECT chirp_events.position::bigint AS id, chirp_events.type, sqlc.embed(chirps), users.is_protected AS author_protected
+FROM chirp_events
+JOIN chirps ON chirps.id = chirp_events.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_events.position = sqlc.arg('id')::bigint;
+
+-- name: ListChirpEventsAfter :many
+SELECT chirp_events.position::bigint AS id, chirp_events.type, sqlc.embed(chirps), users.is_protected AS author_protected
+FROM chirp_events
+JOIN chirps ON chirps.id = chirp_events.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE chirp_events.position > sqlc.arg('id')::bigint
+ORDER BY chirp_events.position ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetLatestChirpEventID :one
+SELECT COALESCE(MAX(position), 0)::bigint FROM chirp_events;
+
+-- name: PruneChirpEvents :execrows
+DELETE FROM chirp_events
+WHERE created_at < $1;
+
+-- name: CanViewChirp :one
+SELECT chirp_visible_to(sqlc.arg('author_id'), sqlc.arg('visibility'), sqlc.arg('viewer_id'));
@@ -1,27 +1,200 @@
+-- CreateChirp publishes the chirp right away unless it has a publish_at.
+
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, visibility, publish_at, published_at, reply_to_id, thread_id, thread_position)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
-    $1,
-    $2
+    sqlc.arg('body'),
+    sqlc.arg('user_id'),
+    sqlc.arg('visibility'),
+    sqlc.narg('publish_at')::timestamp,
+    CASE WHEN sqlc.narg('publish_at')::timestamp IS NULL THEN NOW() END,
+    sqlc.narg('reply_to_id')::uuid,
+    sqlc.narg('thread_id')::uuid,
+    sqlc.narg('thread_position')::integer
 )
 RETURNING *;
 
+-- Chirp reads take the viewer, if signed in, to only return chirps they may
+-- see and, in listings, leave out chirps from users they blocked, were
+-- blocked by or muted.
+
 -- name: GetChirps :many
 SELECT * FROM chirps
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+AND hidden_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, sqlc.narg('viewer_id')::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.narg('viewer_id')::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = sqlc.narg('viewer_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = sqlc.narg('viewer_id')::uuid
+    AND muted_id = chirps.user_id
+)
+ORDER BY published_at ASC;
 
 -- name: GetChirpsByUserid :many
 SELECT * FROM chirps
-WHERE chirps.user_id = $1;
+WHERE chirps.user_id = sqlc.arg('user_id')
+AND deleted_at IS NULL
+AND hidden_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, sqlc.narg('viewer_id')::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.narg('viewer_id')::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = sqlc.narg('viewer_id')::uuid)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE muter_id = sqlc.narg('viewer_id')::uuid
+    AND muted_id = chirps.user_id
+)
+ORDER BY published_at ASC;
+
+-- name: GetVisibleChirp :one
+SELECT * FROM chirps
+WHERE chirps.id = sqlc.arg('id')
+AND deleted_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, sqlc.narg('viewer_id')::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.narg('viewer_id')::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = sqlc.narg('viewer_id')::uuid)
+);
+
+-- name: GetReadableChirp :one
+SELECT * FROM chirps
+WHERE chirps.id = sqlc.arg('id')
+AND deleted_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, sqlc.narg('viewer_id')::uuid);
+
+-- name: GetOwnChirps :many
+SELECT * FROM chirps
+WHERE chirps.user_id = $1
+AND deleted_at IS NULL
+ORDER BY created_at ASC;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE chirps.id = $1;
+WHERE chirps.id = $1
+AND deleted_at IS NULL;
+
+-- name: SoftDeleteChirp :one
+UPDATE chirps
+SET deleted_at = NOW(),
+deleted_by = $2,
+deletion_reason = $3,
+updated_at = NOW()
+WHERE id = $1
+AND deleted_at IS NULL
+RETURNING *;
 
--- name: DeleteChirp :exec
+-- name: ReclassifyChirpDeletion :one
+UPDATE chirps
+SET deleted_by = $2,
+deletion_reason = $3,
+updated_at = NOW()
+WHERE id = $1
+AND deletion_reason = 'owner'
+RETURNING *;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL,
+deleted_by = NULL,
+deletion_reason = NULL,
+updated_at = NOW()
+WHERE id = $1
+AND deleted_at IS NOT NULL
+RETURNING *;
+
+-- name: GetDeletedChirp :one
+SELECT * FROM chirps
+WHERE chirps.id = $1
+AND deleted_at IS NOT NULL;
+
+-- name: ListDeletedChirps :many
+SELECT * FROM chirps
+WHERE deleted_at IS NOT NULL
+AND (sqlc.narg('reason')::text IS NULL OR deletion_reason = sqlc.narg('reason')::text)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+ORDER BY deleted_at DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: PurgeDeletedChirps :execrows
 DELETE FROM chirps
+WHERE deleted_at IS NOT NULL
+AND deleted_at < sqlc.arg('before')::timestamp;
+
+-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
 WHERE id = $1
-AND user_id = $2;
\ No newline at end of file
+AND hidden_at IS NULL;
+
+-- name: UnhideChirp :exec
+UPDATE chirps
+SET hidden_at = NULL
+WHERE id = $1;
+
+-- name: ListScheduledChirps :many
+SELECT * FROM chirps
+WHERE chirps.user_id = $1
+AND published_at IS NULL
+AND deleted_at IS NULL
+ORDER BY publish_at ASC;
+
+-- PublishDueChirps publishes a batch of the scheduled chirps whose time has
+-- come.
+
+-- name: PublishDueChirps :many
+UPDATE chirps
+SET published_at = NOW(),
+updated_at = NOW()
+WHERE chirps.id IN (
+    SELECT due.id FROM chirps due
+    WHERE due.published_at IS NULL
+    AND due.deleted_at IS NULL
+    AND due.publish_at <= NOW()
+    ORDER BY due.publish_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- StartThread makes a chirp the first of a thread.
+
+-- name: StartThread :one
+UPDATE chirps
+SET thread_id = id,
+thread_position = 1
+WHERE id = $1
+RETURNING *;
+
+-- ListThreadChirps returns the chirps of a thread the viewer may see, in
+-- order. They share an author, so either all or none of them are returned
+-- besides deleted or hidden ones.
+
+-- name: ListThreadChirps :many
+SELECT * FROM chirps
+WHERE chirps.thread_id = sqlc.arg('thread_id')
+AND deleted_at IS NULL
+AND hidden_at IS NULL
+AND published_at IS NOT NULL
+AND chirp_visible_to(chirps.user_id, chirps.visibility, sqlc.narg('viewer_id')::uuid)
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = sqlc.narg('viewer_id')::uuid AND blocked_id = chirps.user_id)
+    OR (blocker_id = chirps.user_id AND blocked_id = sqlc.narg('viewer_id')::uuid)
+)
+ORDER BY thread_position ASC;
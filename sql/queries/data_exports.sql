@@ -0,0 +1,51 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    'pending'
+)
+RETURNING *;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports
+WHERE data_exports.id = $1
+AND data_exports.user_id = $2;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready',
+file_path = $2,
+expires_at = $3,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed',
+error = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListExpiredDataExports :many
+SELECT * FROM data_exports
+WHERE status = 'ready'
+AND expires_at <= NOW()
+ORDER BY expires_at
+LIMIT $1;
+
+-- name: ExpireDataExport :exec
+UPDATE data_exports
+SET status = 'expired',
+file_path = NULL,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListPurgeableDataExportFiles :many
+SELECT data_exports.file_path::text FROM data_exports
+JOIN users ON users.id = data_exports.user_id
+WHERE users.delete_after IS NOT NULL
+AND users.delete_after <= NOW()
+AND data_exports.file_path IS NOT NULL;
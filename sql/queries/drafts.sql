@@ -0,0 +1,35 @@
+-- name: CreateDraft :one
+INSERT INTO chirp_drafts (id, created_at, updated_at, user_id, body, visibility)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: ListDrafts :many
+SELECT * FROM chirp_drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC;
+
+-- name: GetDraft :one
+SELECT * FROM chirp_drafts
+WHERE id = $1
+AND user_id = $2;
+
+-- name: UpdateDraft :one
+UPDATE chirp_drafts
+SET body = $3,
+visibility = $4,
+updated_at = NOW()
+WHERE id = $1
+AND user_id = $2
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM chirp_drafts
+WHERE id = $1
+AND user_id = $2;
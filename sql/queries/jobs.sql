@@ -0,0 +1,84 @@
+-- name: EnqueueJob :execrows
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, unique_key, max_attempts, run_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    sqlc.arg('kind'),
+    sqlc.arg('payload'),
+    sqlc.narg('unique_key'),
+    sqlc.arg('max_attempts'),
+    sqlc.arg('run_at')
+)
+ON CONFLICT (unique_key) WHERE unique_key IS NOT NULL DO NOTHING;
+
+-- ClaimJobs picks due jobs, and running jobs whose lease ran out because
+-- their runner died, and leases them to the caller until lease_until.
+
+-- name: ClaimJobs :many
+UPDATE jobs
+SET status = 'running',
+attempts = jobs.attempts + 1,
+locked_until = sqlc.arg('lease_until')::timestamp,
+updated_at = NOW()
+WHERE jobs.id IN (
+    SELECT due.id FROM jobs due
+    WHERE (due.status = 'queued' AND due.run_at <= NOW())
+    OR (due.status = 'running' AND due.locked_until < NOW())
+    ORDER BY due.run_at ASC
+    LIMIT sqlc.arg('batch')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteJob :exec
+UPDATE jobs
+SET status = 'succeeded',
+locked_until = NULL,
+finished_at = NOW(),
+updated_at = NOW()
+WHERE id = $1;
+
+-- FailJob queues a failed job again at next_run_at, unless it used its last
+-- attempt.
+
+-- name: FailJob :exec
+UPDATE jobs
+SET status = CASE WHEN attempts >= max_attempts THEN 'failed' ELSE 'queued' END,
+run_at = sqlc.arg('next_run_at'),
+locked_until = NULL,
+last_error = sqlc.arg('error')::text,
+finished_at = CASE WHEN attempts >= max_attempts THEN NOW() END,
+updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- name: GetJob :one
+SELECT * FROM jobs
+WHERE id = $1;
+
+-- name: ListJobs :many
+SELECT * FROM jobs
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+AND (sqlc.narg('kind')::text IS NULL OR kind = sqlc.narg('kind'))
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- RetryJob queues a failed job again right away, with a fresh set of
+-- attempts.
+
+-- name: RetryJob :one
+UPDATE jobs
+SET status = 'queued',
+attempts = 0,
+run_at = NOW(),
+finished_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+AND status = 'failed'
+RETURNING *;
+
+-- name: PruneJobs :execrows
+DELETE FROM jobs
+WHERE status IN ('succeeded', 'failed')
+AND finished_at < $1;
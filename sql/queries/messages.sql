@@ -0,0 +1,111 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at, created_by)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1
+)
+RETURNING *;
+
+-- name: AddConversationParticipant :exec
+INSERT INTO conversation_participants (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW());
+
+-- LockDirectConversation holds, until the transaction ends, a lock on the
+-- pair of users, so only one one-to-one conversation is started between
+-- them.
+
+-- name: LockDirectConversation :exec
+SELECT pg_advisory_xact_lock(hashtext(
+    'direct_conversation:'
+    || LEAST(sqlc.arg('user_a')::uuid, sqlc.arg('user_b')::uuid)::text
+    || ':'
+    || GREATEST(sqlc.arg('user_a')::uuid, sqlc.arg('user_b')::uuid)::text
+));
+
+-- A one-to-one conversation is reused when it is started again.
+
+-- name: FindDirectConversation :one
+SELECT conversations.* FROM conversations
+WHERE EXISTS (
+    SELECT 1 FROM conversation_participants
+    WHERE conversation_participants.conversation_id = conversations.id
+    AND conversation_participants.user_id = sqlc.arg('user_a')
+)
+AND EXISTS (
+    SELECT 1 FROM conversation_participants
+    WHERE conversation_participants.conversation_id = conversations.id
+    AND conversation_participants.user_id = sqlc.arg('user_b')
+)
+AND (
+    SELECT COUNT(*) FROM conversation_participants
+    WHERE conversation_participants.conversation_id = conversations.id
+) = 2
+ORDER BY created_at ASC
+LIMIT 1;
+
+-- name: GetConversationForParticipant :one
+SELECT conversations.* FROM conversations
+JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id
+WHERE conversations.id = $1
+AND conversation_participants.user_id = $2;
+
+-- name: ListConversations :many
+SELECT
+    conversations.*,
+    (
+        SELECT COUNT(*) FROM messages
+        WHERE messages.conversation_id = conversations.id
+        AND messages.sender_id <> conversation_participants.user_id
+        AND messages.created_at > COALESCE(conversation_participants.last_read_at, '-infinity')
+    ) AS unread_count
+FROM conversations
+JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id
+WHERE conversation_participants.user_id = $1
+ORDER BY conversations.updated_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: ListConversationParticipants :many
+SELECT * FROM conversation_participants
+WHERE conversation_id = $1
+ORDER BY joined_at ASC;
+
+-- name: ListParticipantsOfConversations :many
+SELECT * FROM conversation_participants
+WHERE conversation_id = ANY(sqlc.arg('conversation_ids')::uuid[])
+ORDER BY joined_at ASC;
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: MarkConversationRead :one
+UPDATE conversation_participants
+SET last_read_at = NOW()
+WHERE conversation_id = $1
+AND user_id = $2
+RETURNING *;
+
+-- name: GetSentMessages :many
+SELECT * FROM messages
+WHERE sender_id = $1
+ORDER BY created_at ASC;
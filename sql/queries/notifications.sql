@@ -0,0 +1,46 @@
+-- name: AddNotification :exec
+INSERT INTO notifications (id, created_at, updated_at, user_id, kind, target_type, target_id, group_id, actor_ids)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    sqlc.arg('user_id'),
+    sqlc.arg('kind'),
+    sqlc.arg('target_type'),
+    sqlc.arg('target_id'),
+    sqlc.arg('group_id'),
+    CASE WHEN sqlc.narg('actor_id')::uuid IS NULL THEN '{}'::uuid[]
+    ELSE ARRAY[sqlc.narg('actor_id')::uuid] END
+)
+ON CONFLICT (user_id, kind, group_id) WHERE read_at IS NULL DO UPDATE
+SET updated_at = NOW(),
+target_id = EXCLUDED.target_id,
+event_count = notifications.event_count + 1,
+actor_ids = CASE WHEN sqlc.narg('actor_id')::uuid IS NULL THEN notifications.actor_ids
+    ELSE array_prepend(sqlc.narg('actor_id')::uuid, array_remove(notifications.actor_ids, sqlc.narg('actor_id')::uuid)) END;
+
+-- name: ListNotifications :many
+SELECT notifications.*, users.email AS latest_actor_email
+FROM notifications
+LEFT JOIN users ON users.id = notifications.actor_ids[1]
+WHERE notifications.user_id = sqlc.arg('user_id')
+AND (NOT sqlc.arg('unread_only')::boolean OR notifications.read_at IS NULL)
+ORDER BY notifications.updated_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1
+AND read_at IS NULL;
+
+-- name: MarkNotificationRead :execrows
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1
+AND user_id = $2;
+
+-- name: MarkAllNotificationsRead :exec
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1
+AND read_at IS NULL;
@@ -0,0 +1,73 @@
+-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, created_at, closes_at)
+VALUES ($1, NOW(), $2);
+
+-- name: AddPollOption :exec
+INSERT INTO poll_options (chirp_id, position, label)
+VALUES ($1, $2, $3);
+
+-- ListPollOptions returns the options of the polls of the given chirps, with
+-- their tallies and the option the viewer voted for, if any.
+
+-- name: ListPollOptions :many
+SELECT polls.chirp_id, polls.closes_at, polls.closed_at,
+    poll_options.position, poll_options.label,
+    COALESCE(poll_options.votes, tally.votes, 0)::bigint AS votes,
+    mine.position AS voted_position
+FROM polls
+JOIN poll_options ON poll_options.chirp_id = polls.chirp_id
+LEFT JOIN (
+    SELECT poll_votes.chirp_id, poll_votes.position, COUNT(*) AS votes
+    FROM poll_votes
+    WHERE poll_votes.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+    GROUP BY poll_votes.chirp_id, poll_votes.position
+) tally ON tally.chirp_id = poll_options.chirp_id
+    AND tally.position = poll_options.position
+LEFT JOIN poll_votes mine ON mine.chirp_id = polls.chirp_id
+    AND mine.user_id = sqlc.narg('viewer_id')::uuid
+WHERE polls.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY polls.chirp_id, poll_options.position;
+
+-- name: GetPoll :one
+SELECT * FROM polls
+WHERE chirp_id = $1;
+
+-- CastVote records a vote while the poll is open. Nothing is recorded if
+-- the user already voted.
+
+-- name: CastVote :execrows
+INSERT INTO poll_votes (chirp_id, user_id, position, created_at)
+SELECT polls.chirp_id, sqlc.arg('user_id'), sqlc.arg('position'), NOW()
+FROM polls
+WHERE polls.chirp_id = sqlc.arg('chirp_id')
+AND polls.closed_at IS NULL
+AND polls.closes_at > NOW()
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- ClosePolls marks a batch of the polls past their closing time closed.
+
+-- name: ClosePolls :many
+UPDATE polls
+SET closed_at = NOW()
+WHERE polls.chirp_id IN (
+    SELECT due.chirp_id FROM polls due
+    WHERE due.closed_at IS NULL
+    AND due.closes_at <= NOW()
+    ORDER BY due.closes_at ASC
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING polls.chirp_id;
+
+-- name: RecordPollTallies :exec
+UPDATE poll_options
+SET votes = (
+    SELECT COUNT(*) FROM poll_votes tally
+    WHERE tally.chirp_id = poll_options.chirp_id
+    AND tally.position = poll_options.position
+)
+WHERE poll_options.chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[]);
+
+-- name: ListPollVoters :many
+SELECT user_id FROM poll_votes
+WHERE chirp_id = $1;
@@ -0,0 +1,22 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (
+    sqlc.arg(key),
+    sqlc.arg(capacity)::float8 - 1,
+    true,
+    NOW()
+)
+ON CONFLICT (key) DO UPDATE
+SET
+    tokens = CASE
+        WHEN LEAST(sqlc.arg(capacity)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1
+        THEN LEAST(sqlc.arg(capacity)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8) - 1
+        ELSE LEAST(sqlc.arg(capacity)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8)
+    END,
+    allowed = LEAST(sqlc.arg(capacity)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1,
+    updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: PruneRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
@@ -0,0 +1,32 @@
+-- name: SetUserProtected :one
+UPDATE users
+SET is_protected = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING *;
+
+-- name: RequestReaderAccess :one
+INSERT INTO reader_access (owner_id, reader_id, status, created_at, updated_at)
+VALUES ($1, $2, 'pending', NOW(), NOW())
+ON CONFLICT (owner_id, reader_id) DO UPDATE
+SET updated_at = reader_access.updated_at
+RETURNING *;
+
+-- name: ApproveReader :one
+UPDATE reader_access
+SET status = 'approved',
+updated_at = NOW()
+WHERE owner_id = $1
+AND reader_id = $2
+RETURNING *;
+
+-- name: RemoveReader :execrows
+DELETE FROM reader_access
+WHERE owner_id = $1
+AND reader_id = $2;
+
+-- name: ListReaders :many
+SELECT * FROM reader_access
+WHERE owner_id = sqlc.arg('owner_id')
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+ORDER BY created_at DESC;
@@ -10,15 +10,29 @@ VALUES (
 )
 RETURNING *;
 
--- name: RevokeRefreshToken :exec
+-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens
 SET 
     revoked_at = NOW(),
     updated_at = NOW()
-WHERE token = $1;
+WHERE token = $1
+RETURNING user_id;
 
 -- name: GetUserFromRefreshToken :one
 SELECT user_id FROM refresh_tokens
 WHERE refresh_tokens.token = $1
 AND refresh_tokens.expires_at > NOW()
-AND refresh_tokens.revoked_at IS NULL;
\ No newline at end of file
+AND refresh_tokens.revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: GetRefreshTokensByUser :many
+SELECT * FROM refresh_tokens
+WHERE refresh_tokens.user_id = $1
+ORDER BY created_at ASC;
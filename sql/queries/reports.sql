@@ -0,0 +1,62 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, reporter_id, target_type, chirp_id, user_id, reason, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: CountPendingChirpReporters :one
+SELECT COUNT(DISTINCT reporter_id) FROM reports
+WHERE chirp_id = $1
+AND status <> 'resolved';
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE reports.id = $1;
+
+-- name: ListReports :many
+SELECT * FROM reports
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+AND (sqlc.narg('status')::text IS NOT NULL OR sqlc.arg('include_resolved')::boolean OR status <> 'resolved')
+AND (sqlc.narg('target_type')::text IS NULL OR target_type = sqlc.narg('target_type')::text)
+AND (sqlc.narg('reason')::text IS NULL OR reason = sqlc.narg('reason')::text)
+ORDER BY created_at ASC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed',
+claimed_by = $2,
+claimed_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2))
+RETURNING *;
+
+-- ResolveReportsForTarget resolves the pending reports on the target of
+-- report_id, leaving that report out when another admin claimed it. Reports
+-- resolved concurrently are waited for and skipped, so report_id is only
+-- returned by the admin who got there first.
+
+-- name: ResolveReportsForTarget :many
+UPDATE reports
+SET status = 'resolved',
+resolved_by = sqlc.arg('resolved_by'),
+resolved_at = NOW(),
+resolution = sqlc.arg('resolution'),
+updated_at = NOW()
+WHERE status <> 'resolved'
+AND target_type = sqlc.arg('target_type')
+AND user_id = sqlc.arg('user_id')
+AND chirp_id IS NOT DISTINCT FROM sqlc.narg('chirp_id')
+AND (id <> sqlc.arg('report_id') OR claimed_by IS NULL OR claimed_by = sqlc.arg('resolved_by'))
+RETURNING *;
@@ -9,15 +9,15 @@ VALUES (
 )
 RETURNING *;
 
--- name: DeleteUser :one
+-- name: DeleteNonAdminUsers :execrows
 DELETE FROM users
-RETURNING *;
+WHERE role <> 'admin';
 
 -- name: GetUserByEmail :one
 SELECT * FROM users
 WHERE users.email = $1;
 
--- name: UpgradeUser :exec
+-- name: UpgradeUser :execrows
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1;
@@ -28,4 +28,68 @@ SET email = $2,
 hashed_password = $3,
 updated_at = NOW()
 WHERE users.id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
\ No newline at end of file
+RETURNING id, created_at, updated_at, email, is_chirpy_red, is_protected;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE users.id = $1;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET delete_after = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING delete_after;
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+SET delete_after = NULL,
+updated_at = NOW()
+WHERE users.id = $1;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE delete_after IS NOT NULL
+AND delete_after <= NOW();
+
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE (sqlc.narg('query')::text IS NULL OR strpos(lower(email), lower(sqlc.narg('query')::text)) > 0)
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+AND (sqlc.narg('role')::text IS NULL OR role = sqlc.narg('role')::text)
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
+
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE users.id = $1
+FOR UPDATE;
+
+-- name: SetUserStatus :one
+UPDATE users
+SET status = $2,
+suspended_until = $3,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING *;
+
+-- name: SetUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING *;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2,
+updated_at = NOW()
+WHERE users.id = $1
+RETURNING *;
+
+-- name: ListMentionedUsers :many
+SELECT users.id FROM users
+WHERE lower(split_part(users.email, '@', 1)) = ANY(sqlc.arg('names')::text[])
+AND users.id <> sqlc.arg('author_id')
+AND chirp_visible_to(sqlc.arg('author_id'), sqlc.arg('visibility'), users.id);
@@ -0,0 +1,103 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, url, event_types, secret, created_by)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1;
+
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+ORDER BY created_at DESC;
+
+-- name: UpdateWebhook :one
+UPDATE webhooks
+SET url = $2,
+event_types = $3,
+active = $4,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks
+WHERE id = $1;
+
+-- EnqueueWebhookDeliveries adds a delivery of an event to every active
+-- webhook subscribed to its type, or only to the given webhook if set.
+
+-- name: EnqueueWebhookDeliveries :exec
+INSERT INTO webhook_deliveries (id, created_at, updated_at, webhook_id, event_id, event_type, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), NOW(), webhooks.id, sqlc.arg('event_id'), sqlc.arg('event_type'), sqlc.arg('payload'), NOW()
+FROM webhooks
+WHERE webhooks.active
+AND (sqlc.narg('webhook_id')::uuid IS NULL OR webhooks.id = sqlc.narg('webhook_id')::uuid)
+AND (sqlc.narg('webhook_id')::uuid IS NOT NULL OR sqlc.arg('event_type')::text = ANY(webhooks.event_types));
+
+-- ClaimWebhookDeliveries picks due deliveries and pushes their next attempt
+-- back to the end of a lease, so another replica only retries them if this
+-- one dies before recording the attempt.
+
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg('lease_until'),
+updated_at = NOW()
+FROM webhooks
+WHERE webhooks.id = webhook_deliveries.webhook_id
+AND webhook_deliveries.id IN (
+    SELECT pending.id FROM webhook_deliveries pending
+    WHERE pending.status = 'pending'
+    AND pending.next_attempt_at <= NOW()
+    ORDER BY pending.next_attempt_at ASC
+    LIMIT sqlc.arg('batch')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING webhook_deliveries.*, webhooks.url, webhooks.secret;
+
+-- name: RecordWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered',
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+last_status_code = $2,
+last_error = NULL,
+delivered_at = NOW(),
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: RecordWebhookFailure :exec
+UPDATE webhook_deliveries
+SET status = CASE WHEN attempts + 1 >= sqlc.arg('max_attempts')::int THEN 'dead' ELSE 'pending' END,
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+last_status_code = sqlc.narg('status_code'),
+last_error = sqlc.arg('error')::text,
+next_attempt_at = sqlc.arg('next_attempt_at'),
+updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg('webhook_id')
+AND (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: RedeliverWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending',
+attempts = 0,
+next_attempt_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND webhook_id = $2
+RETURNING *;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN delete_after;
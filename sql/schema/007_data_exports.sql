@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending',
+    file_path TEXT,
+    error TEXT
+);
+
+-- +goose Down
+DROP TABLE data_exports;
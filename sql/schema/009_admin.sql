@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin')),
+ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'suspended', 'banned')),
+ADD COLUMN suspended_until TIMESTAMP;
+
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id UUID,
+    details JSONB NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+-- +goose Down
+DROP TABLE audit_events;
+
+ALTER TABLE users
+DROP COLUMN suspended_until,
+DROP COLUMN status,
+DROP COLUMN role;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- Events outlive the users they mention, so actors are no longer a foreign
+-- key: deleting a user must not rewrite the log.
+ALTER TABLE audit_events
+DROP CONSTRAINT audit_events_actor_id_fkey,
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id, created_at);
+CREATE INDEX audit_events_target_id_idx ON audit_events (target_id, created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Rows can still be deleted, by the retention job.
+CREATE TRIGGER audit_events_no_update
+BEFORE UPDATE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TRIGGER audit_events_no_update ON audit_events;
+DROP FUNCTION audit_events_append_only();
+DROP INDEX audit_events_target_id_idx;
+DROP INDEX audit_events_actor_id_idx;
+
+ALTER TABLE audit_events
+DROP COLUMN request_id,
+DROP COLUMN user_agent,
+DROP COLUMN ip,
+ADD CONSTRAINT audit_events_actor_id_fkey
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL;
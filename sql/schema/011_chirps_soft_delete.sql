@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN deleted_at TIMESTAMP,
+ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+ADD COLUMN deletion_reason TEXT
+    CHECK (deletion_reason IN ('owner', 'moderator', 'legal')),
+ADD CONSTRAINT chirps_deletion_check
+    CHECK ((deleted_at IS NULL) = (deletion_reason IS NULL));
+
+CREATE INDEX chirps_deleted_at_idx ON chirps (deleted_at)
+WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX chirps_deleted_at_idx;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_deletion_check,
+DROP COLUMN deletion_reason,
+DROP COLUMN deleted_by,
+DROP COLUMN deleted_at;
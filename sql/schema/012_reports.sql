@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type TEXT NOT NULL CHECK (target_type IN ('chirp', 'user')),
+    -- Set for chirp reports only. user_id is the reported user, the author
+    -- of the chirp for chirp reports.
+    chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL
+        CHECK (reason IN ('spam', 'harassment', 'hate', 'violence', 'sexual', 'self_harm', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'claimed', 'resolved')),
+    claimed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    claimed_at TIMESTAMP,
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    resolution TEXT
+        CHECK (resolution IN ('dismissed', 'chirp_removed', 'user_suspended')),
+    CHECK ((target_type = 'chirp') = (chirp_id IS NOT NULL))
+);
+
+-- A reporter has at most one pending report per chirp or user.
+CREATE UNIQUE INDEX reports_pending_chirp_idx ON reports (reporter_id, chirp_id)
+WHERE target_type = 'chirp' AND status <> 'resolved';
+CREATE UNIQUE INDEX reports_pending_user_idx ON reports (reporter_id, user_id)
+WHERE target_type = 'user' AND status <> 'resolved';
+CREATE INDEX reports_queue_idx ON reports (status, created_at);
+
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
+
+DROP TABLE reports;
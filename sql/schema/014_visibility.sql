@@ -0,0 +1,48 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN is_protected BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE chirps
+ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'readers', 'private'));
+
+-- Readers of protected accounts: pending until the owner approves them.
+CREATE TABLE reader_access (
+    owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reader_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved')),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (owner_id, reader_id),
+    CHECK (owner_id <> reader_id)
+);
+
+-- chirp_visible_to tells whether viewer, NULL when signed out, may read a
+-- chirp: authors see all theirs, approved readers see public and readers
+-- chirps, anyone else only public chirps of accounts that aren't protected.
+-- +goose StatementBegin
+CREATE FUNCTION chirp_visible_to(chirp_author UUID, chirp_visibility TEXT, viewer UUID)
+RETURNS BOOLEAN AS $$
+    SELECT COALESCE(chirp_author = viewer, false)
+    OR (chirp_visibility = 'public'
+        AND NOT (SELECT is_protected FROM users WHERE users.id = chirp_author))
+    OR (chirp_visibility IN ('public', 'readers')
+        AND EXISTS (
+            SELECT 1 FROM reader_access
+            WHERE owner_id = chirp_author
+            AND reader_id = viewer
+            AND status = 'approved'
+        ))
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION chirp_visible_to(UUID, TEXT, UUID);
+DROP TABLE reader_access;
+
+ALTER TABLE chirps
+DROP COLUMN visibility;
+
+ALTER TABLE users
+DROP COLUMN is_protected;
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Notifications of the same kind on the same target are grouped into one
+-- row while it is unread: actor_ids holds who caused them, most recent
+-- first, and event_count how many there were.
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id UUID NOT NULL,
+    actor_ids UUID[] NOT NULL DEFAULT '{}',
+    event_count INTEGER NOT NULL DEFAULT 1,
+    read_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, kind, target_id)
+    WHERE read_at IS NULL;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications (user_id, updated_at DESC);
+
+-- +goose Down
+DROP TABLE notifications;
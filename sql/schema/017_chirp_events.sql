@@ -0,0 +1,50 @@
+-- +goose Up
+-- chirp_events logs changes to chirps for the live stream, so clients can
+-- resume from the last event they saw. Each insert is announced on the
+-- chirp_events channel once its transaction commits.
+CREATE TABLE chirp_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('created', 'deleted', 'restored'))
+);
+
+CREATE INDEX chirp_events_created_at_idx ON chirp_events (created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION log_chirp_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'created');
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'deleted');
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'restored');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_log_event
+AFTER INSERT OR UPDATE OF deleted_at ON chirps
+FOR EACH ROW EXECUTE FUNCTION log_chirp_event();
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_chirp_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('chirp_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirp_events_notify
+AFTER INSERT ON chirp_events
+FOR EACH ROW EXECUTE FUNCTION notify_chirp_event();
+
+-- +goose Down
+DROP TRIGGER chirps_log_event ON chirps;
+DROP TABLE chirp_events;
+DROP FUNCTION notify_chirp_event();
+DROP FUNCTION log_chirp_event();
@@ -0,0 +1,31 @@
+-- +goose Up
+-- jobs is the background work queue. Jobs are written in the transaction
+-- that needs them done, then claimed by the runners of any replica with
+-- FOR UPDATE SKIP LOCKED and retried with backoff until they succeed or run
+-- out of attempts.
+CREATE TABLE jobs (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    kind TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    -- unique_key keeps a job from being queued twice, such as the same run
+    -- of a scheduled job by several replicas.
+    unique_key TEXT,
+    status TEXT NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    finished_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (unique_key) WHERE unique_key IS NOT NULL;
+CREATE INDEX jobs_queued_run_at_idx ON jobs (run_at) WHERE status = 'queued';
+CREATE INDEX jobs_running_locked_until_idx ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX jobs_status_created_at_idx ON jobs (status, created_at DESC);
+
+-- +goose Down
+DROP TABLE jobs;
@@ -0,0 +1,75 @@
+-- +goose Up
+-- Scheduled chirps are stored with their publish_at and no published_at
+-- until the publisher makes them visible.
+ALTER TABLE chirps ADD COLUMN publish_at TIMESTAMP;
+ALTER TABLE chirps ADD COLUMN published_at TIMESTAMP;
+UPDATE chirps SET published_at = created_at;
+
+CREATE INDEX chirps_scheduled_idx ON chirps (publish_at)
+    WHERE published_at IS NULL AND deleted_at IS NULL;
+
+-- Drafts aren't validated until they are published as chirps.
+CREATE TABLE chirp_drafts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    visibility TEXT NOT NULL DEFAULT 'public'
+        CHECK (visibility IN ('public', 'readers', 'private'))
+);
+
+CREATE INDEX chirp_drafts_user_id_updated_at_idx ON chirp_drafts (user_id, updated_at DESC);
+
+-- Publishing a scheduled chirp is its creation as far as the stream is
+-- concerned, and nothing happening to it before is streamed.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION log_chirp_event() RETURNS trigger AS $$
+BEGIN
+    IF NEW.published_at IS NULL THEN
+        RETURN NEW;
+    END IF;
+    IF TG_OP = 'INSERT' OR OLD.published_at IS NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'created');
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'deleted');
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'restored');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TRIGGER chirps_log_event ON chirps;
+CREATE TRIGGER chirps_log_event
+AFTER INSERT OR UPDATE OF deleted_at, published_at ON chirps
+FOR EACH ROW EXECUTE FUNCTION log_chirp_event();
+
+-- +goose Down
+DROP TRIGGER chirps_log_event ON chirps;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION log_chirp_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'created');
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'deleted');
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        INSERT INTO chirp_events (created_at, chirp_id, type) VALUES (NOW(), NEW.id, 'restored');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_log_event
+AFTER INSERT OR UPDATE OF deleted_at ON chirps
+FOR EACH ROW EXECUTE FUNCTION log_chirp_event();
+
+DROP TABLE chirp_drafts;
+-- Scheduled chirps would show up as published.
+DELETE FROM chirps WHERE published_at IS NULL;
+ALTER TABLE chirps DROP COLUMN published_at;
+ALTER TABLE chirps DROP COLUMN publish_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Threads are reply chains posted at once. Every chirp of a thread has the
+-- thread_id of its first chirp and its thread_position, starting at 1.
+-- thread_id isn't a foreign key so the rest of a thread outlives its first
+-- chirp being purged.
+ALTER TABLE chirps ADD COLUMN reply_to_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+ALTER TABLE chirps ADD COLUMN thread_id UUID;
+ALTER TABLE chirps ADD COLUMN thread_position INTEGER;
+
+CREATE INDEX chirps_thread_id_thread_position_idx ON chirps (thread_id, thread_position)
+    WHERE thread_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE chirps DROP COLUMN thread_position;
+ALTER TABLE chirps DROP COLUMN thread_id;
+ALTER TABLE chirps DROP COLUMN reply_to_id;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- A chirp has at most one poll. Tallies are counted from poll_votes while
+-- the poll is open; closed_at and the final votes of each option are set
+-- by the job closing polls once closes_at has passed.
+CREATE TABLE polls (
+    chirp_id UUID PRIMARY KEY REFERENCES chirps(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    closes_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP
+);
+
+CREATE INDEX polls_open_closes_at_idx ON polls (closes_at) WHERE closed_at IS NULL;
+
+CREATE TABLE poll_options (
+    chirp_id UUID NOT NULL REFERENCES polls(chirp_id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    label TEXT NOT NULL,
+    votes INTEGER,
+    PRIMARY KEY (chirp_id, position)
+);
+
+-- The primary key allows a single vote per user and poll.
+CREATE TABLE poll_votes (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id),
+    FOREIGN KEY (chirp_id, position) REFERENCES poll_options(chirp_id, position) ON DELETE CASCADE
+);
+
+CREATE INDEX poll_votes_chirp_id_position_idx ON poll_votes (chirp_id, position);
+
+-- +goose Down
+DROP TABLE poll_votes;
+DROP TABLE poll_options;
+DROP TABLE polls;
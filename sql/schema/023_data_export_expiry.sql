@@ -0,0 +1,10 @@
+-- +goose Up
+-- Ready archives expire after EXPORT_TTL; a job then removes their file and
+-- marks them expired.
+ALTER TABLE data_exports ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX data_exports_ready_expires_at_idx ON data_exports (expires_at) WHERE status = 'ready';
+
+-- +goose Down
+DROP INDEX data_exports_ready_expires_at_idx;
+ALTER TABLE data_exports DROP COLUMN expires_at;
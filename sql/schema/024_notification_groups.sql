@@ -0,0 +1,21 @@
+-- +goose Up
+-- Unread notifications are grouped on group_id rather than their target, so
+-- kinds whose targets only ever have one actor, such as mentions, can still
+-- collect several: target_id then is the latest one.
+ALTER TABLE notifications ADD COLUMN group_id UUID;
+UPDATE notifications SET group_id = target_id;
+ALTER TABLE notifications ALTER COLUMN group_id SET NOT NULL;
+
+DROP INDEX notifications_unread_group_idx;
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, kind, group_id)
+    WHERE read_at IS NULL;
+
+-- +goose Down
+-- Groups of several targets can't be split back, so they are marked read.
+UPDATE notifications SET read_at = NOW()
+WHERE read_at IS NULL
+AND group_id <> target_id;
+DROP INDEX notifications_unread_group_idx;
+ALTER TABLE notifications DROP COLUMN group_id;
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, kind, target_id)
+    WHERE read_at IS NULL;
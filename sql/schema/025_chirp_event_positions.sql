@@ -0,0 +1,59 @@
+-- +goose Up
+-- Event IDs are handed out when events are inserted, not when their
+-- transaction commits, so an event could become visible after one with a
+-- higher ID was streamed, and clients resuming from that ID would never see
+-- it. Events now get a position just before their transaction commits,
+-- under a lock held until the commit is done, so positions are visible in
+-- order and resuming from one misses nothing. Writers of chirp events
+-- queue on that lock for the end of their commit only.
+CREATE SEQUENCE chirp_events_position_seq;
+ALTER TABLE chirp_events ADD COLUMN position BIGINT;
+UPDATE chirp_events SET position = id;
+SELECT setval('chirp_events_position_seq', COALESCE(MAX(id), 0) + 1, false) FROM chirp_events;
+CREATE UNIQUE INDEX chirp_events_position_idx ON chirp_events (position);
+
+DROP TRIGGER chirp_events_notify ON chirp_events;
+DROP FUNCTION notify_chirp_event();
+
+-- +goose StatementBegin
+CREATE FUNCTION position_chirp_event() RETURNS trigger AS $$
+DECLARE
+    event_position BIGINT;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('chirp_events_position'));
+    UPDATE chirp_events SET position = nextval('chirp_events_position_seq')
+    WHERE id = NEW.id
+    RETURNING position INTO event_position;
+    IF FOUND THEN
+        PERFORM pg_notify('chirp_events', event_position::text);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE CONSTRAINT TRIGGER chirp_events_position
+AFTER INSERT ON chirp_events
+DEFERRABLE INITIALLY DEFERRED
+FOR EACH ROW EXECUTE FUNCTION position_chirp_event();
+
+-- +goose Down
+DROP TRIGGER chirp_events_position ON chirp_events;
+DROP FUNCTION position_chirp_event();
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_chirp_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('chirp_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirp_events_notify
+AFTER INSERT ON chirp_events
+FOR EACH ROW EXECUTE FUNCTION notify_chirp_event();
+
+DROP INDEX chirp_events_position_idx;
+ALTER TABLE chirp_events DROP COLUMN position;
+DROP SEQUENCE chirp_events_position_seq;